@@ -4,5 +4,11 @@ set -exuo pipefail
 cd "$( dirname "${BASH_SOURCE[0]}" )/.."
 source .envrc
 
+# A package holds binaries for one architecture: GOARCH=arm64 for arm64 cells.
+export GOARCH=${GOARCH:-amd64}
+
+GOOS=linux go build -ldflags="-s -w" -o bin/detect nodejs/detect/cli
 GOOS=linux go build -ldflags="-s -w" -o bin/supply nodejs/supply/cli
 GOOS=linux go build -ldflags="-s -w" -o bin/finalize nodejs/finalize/cli
+GOOS=linux go build -ldflags="-s -w" -o bin/release nodejs/release/cli
+GOOS=linux CGO_ENABLED=0 go build -ldflags="-s -w" -o bin/launch-env nodejs/launch/cli
@@ -1,23 +1,45 @@
 #!/bin/bash
 set -euo pipefail
 
-GO_VERSION="1.9.1"
+case "$(uname -m)" in
+  x86_64|amd64)
+    GO_VERSION="1.9.1"
+    GO_MD5="0571886e9b9ba07773b542a11e9859a4"
+    URL=https://buildpacks.cloudfoundry.org/dependencies/go/go${GO_VERSION}.linux-amd64-${GO_MD5:0:8}.tar.gz
+    ;;
+  aarch64|arm64)
+    # The buildpacks bucket has no arm64 go, so take the official tarball.
+    GO_VERSION="1.13.11"
+    GO_SHA256="6c81c0ce79be2bd3ac5ea69c709ea9bd588069632ded4ac39d58dadf4d2f93e6"
+    URL=https://dl.google.com/go/go${GO_VERSION}.linux-arm64.tar.gz
+    ;;
+  *)
+    echo "       **ERROR** No go toolchain for $(uname -m); use a packaged buildpack instead"
+    exit 1
+    ;;
+esac
 
 export GoInstallDir="/tmp/go$GO_VERSION"
 mkdir -p $GoInstallDir
 
 if [ ! -f $GoInstallDir/go/bin/go ]; then
-  GO_MD5="0571886e9b9ba07773b542a11e9859a4"
-  URL=https://buildpacks.cloudfoundry.org/dependencies/go/go${GO_VERSION}.linux-amd64-${GO_MD5:0:8}.tar.gz
-
   echo "-----> Download go ${GO_VERSION}"
-  curl -s -L --retry 15 --retry-delay 2 $URL -o /tmp/go.tar.gz
-
-  DOWNLOAD_MD5=$(md5sum /tmp/go.tar.gz | cut -d ' ' -f 1)
-
-  if [[ $DOWNLOAD_MD5 != $GO_MD5 ]]; then
-    echo "       **ERROR** MD5 mismatch: got $DOWNLOAD_MD5 expected $GO_MD5"
-    exit 1
+  curl -s -f -L --retry 15 --retry-delay 2 $URL -o /tmp/go.tar.gz
+
+  if [[ -n ${GO_MD5:-} ]]; then
+    DOWNLOAD_MD5=$(md5sum /tmp/go.tar.gz | cut -d ' ' -f 1)
+
+    if [[ $DOWNLOAD_MD5 != $GO_MD5 ]]; then
+      echo "       **ERROR** MD5 mismatch: got $DOWNLOAD_MD5 expected $GO_MD5"
+      exit 1
+    fi
+  else
+    DOWNLOAD_SHA256=$(sha256sum /tmp/go.tar.gz | cut -d ' ' -f 1)
+
+    if [[ $DOWNLOAD_SHA256 != $GO_SHA256 ]]; then
+      echo "       **ERROR** SHA256 mismatch: got $DOWNLOAD_SHA256 expected $GO_SHA256"
+      exit 1
+    fi
   fi
 
   tar xzf /tmp/go.tar.gz -C $GoInstallDir
@@ -27,4 +49,3 @@ if [ ! -f $GoInstallDir/go/bin/go ]; then
   echo "       **ERROR** Could not download go"
   exit 1
 fi
-
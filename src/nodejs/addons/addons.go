@@ -0,0 +1,211 @@
+package addons
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"io"
+	"nodejs/arch"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// Addon is a compiled .node file found in node_modules.
+type Addon struct {
+	// Path is relative to the directory that was scanned.
+	Path    string
+	Package string
+	// Platform is linux, darwin, windows or unknown.
+	Platform string
+	// Arch uses Go's names, such as amd64.
+	Arch string
+	// ABI is the NODE_MODULE_VERSION the addon registers with, "napi" for
+	// N-API addons, which load on any node, or empty when it cannot be told.
+	ABI string
+}
+
+var (
+	registerSymbol = regexp.MustCompile(`^node_register_module_v(\d+)$`)
+	// Prebuilt addons often ship a binary per platform, and only load the
+	// one matching the running node.
+	otherPlatform = regexp.MustCompile(`(^|[^a-z])(darwin|macos|win32|windows|freebsd|openbsd|sunos|aix|android|musl|alpine)([^a-z]|$)`)
+	linuxArch     = regexp.MustCompile(`linux-([a-z0-9]+)`)
+	pathABI       = regexp.MustCompile(`(?:node-v|abi)(\d+)`)
+)
+
+// Scan finds the addons in dir/node_modules that a linux node on goarch
+// with the given ABI could load. Binaries under a path naming another
+// platform, architecture or ABI are alternatives for other hosts and are
+// skipped, as are symlinked directories.
+func Scan(dir, goarch, abi string) ([]Addon, error) {
+	var found []Addon
+
+	root := filepath.Join(dir, "node_modules")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(path) != ".node" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if alternative(rel, goarch, abi) {
+			return nil
+		}
+
+		addon, err := read(path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", rel, err)
+		}
+		addon.Path = rel
+		addon.Package = packageName(rel)
+		found = append(found, addon)
+		return nil
+	})
+	return found, err
+}
+
+// Problem explains why the addon cannot load on linux/goarch with the
+// given ABI, or returns "" when it can.
+func (a Addon) Problem(goarch, abi string) string {
+	switch {
+	case a.Platform != "linux":
+		return "built for " + a.Platform
+	case a.Arch != arch.Normalize(goarch):
+		return "built for " + a.Arch
+	case a.ABI != "" && a.ABI != "napi" && a.ABI != abi:
+		return fmt.Sprintf("built for NODE_MODULE_VERSION %s, node here uses %s", a.ABI, abi)
+	}
+	return ""
+}
+
+// Table lays addons out in columns for the staging log.
+func Table(addons []Addon, goarch, abi string) string {
+	buffer := new(bytes.Buffer)
+	table := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PACKAGE\tFILE\tPROBLEM")
+	for _, a := range addons {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", a.Package, a.Path, a.Problem(goarch, abi))
+	}
+	table.Flush()
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+func read(path string) (Addon, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Addon{}, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return Addon{Platform: "unknown", Arch: "unknown"}, nil
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		return readELF(f)
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		return Addon{Platform: "windows", Arch: "unknown"}, nil
+	}
+
+	if m, err := macho.NewFile(f); err == nil {
+		return Addon{Platform: "darwin", Arch: machoArch(m.Cpu)}, nil
+	}
+	if fat, err := macho.NewFatFile(f); err == nil {
+		return Addon{Platform: "darwin", Arch: machoArch(fat.Arches[0].Cpu)}, nil
+	}
+	return Addon{Platform: "unknown", Arch: "unknown"}, nil
+}
+
+func readELF(r io.ReaderAt) (Addon, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return Addon{}, err
+	}
+	defer f.Close()
+
+	addon := Addon{Platform: "linux"}
+	switch f.Machine {
+	case elf.EM_X86_64:
+		addon.Arch = "amd64"
+	case elf.EM_AARCH64:
+		addon.Arch = "arm64"
+	case elf.EM_386:
+		addon.Arch = "386"
+	case elf.EM_ARM:
+		addon.Arch = "arm"
+	default:
+		addon.Arch = strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+	}
+
+	// Addons only name their ABI in a symbol when built with
+	// NODE_MODULE_INIT or N-API; older ones register from a constructor.
+	symbols, _ := f.DynamicSymbols()
+	for _, symbol := range symbols {
+		if symbol.Name == "napi_register_module_v1" {
+			addon.ABI = "napi"
+			break
+		}
+		if match := registerSymbol.FindStringSubmatch(symbol.Name); match != nil {
+			addon.ABI = match[1]
+		}
+	}
+	return addon, nil
+}
+
+// machoCPUArm64 is macho.CpuArm64, which only exists from Go 1.11; the
+// buildpack's binaries are built with Go 1.9.
+const machoCPUArm64 = macho.Cpu(0x0100000c)
+
+func machoArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case machoCPUArm64:
+		return "arm64"
+	}
+	return strings.ToLower(cpu.String())
+}
+
+func alternative(rel, goarch, abi string) bool {
+	for _, segment := range strings.Split(strings.ToLower(filepath.ToSlash(rel)), "/") {
+		if otherPlatform.MatchString(segment) {
+			return true
+		}
+		if match := linuxArch.FindStringSubmatch(segment); match != nil && arch.Normalize(match[1]) != arch.Normalize(goarch) {
+			return true
+		}
+		if match := pathABI.FindStringSubmatch(segment); match != nil && abi != "" && match[1] != abi {
+			return true
+		}
+	}
+	return false
+}
+
+// packageName takes the package from the last node_modules in path.
+func packageName(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i := len(segments) - 2; i >= 0; i-- {
+		if segments[i] != "node_modules" || i+1 >= len(segments)-1 {
+			continue
+		}
+		if strings.HasPrefix(segments[i+1], "@") && i+2 < len(segments)-1 {
+			return segments[i+1] + "/" + segments[i+2]
+		}
+		return segments[i+1]
+	}
+	return ""
+}
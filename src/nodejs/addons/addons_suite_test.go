@@ -0,0 +1,13 @@
+package addons_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAddons(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Addons Suite")
+}
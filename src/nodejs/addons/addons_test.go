@@ -0,0 +1,172 @@
+package addons_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"encoding/binary"
+	"io/ioutil"
+	"nodejs/addons"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// writeELF writes a shared object for machine whose dynamic symbol table
+// holds symbols, which is all Scan reads.
+func writeELF(path string, machine elf.Machine, symbols ...string) {
+	strtab := []byte{0}
+	syms := []elf.Sym64{{}}
+	for _, name := range symbols {
+		syms = append(syms, elf.Sym64{Name: uint32(len(strtab)), Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC), Shndx: 1})
+		strtab = append(append(strtab, name...), 0)
+	}
+	for len(strtab)%8 != 0 {
+		strtab = append(strtab, 0)
+	}
+
+	strtabOff := uint64(64)
+	symtabOff := strtabOff + uint64(len(strtab))
+	shOff := symtabOff + uint64(len(syms)*elf.Sym64Size)
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shOff,
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     3,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	sections := []elf.Section64{
+		{},
+		{Type: uint32(elf.SHT_STRTAB), Off: strtabOff, Size: uint64(len(strtab)), Addralign: 1},
+		{Type: uint32(elf.SHT_DYNSYM), Off: symtabOff, Size: uint64(len(syms) * elf.Sym64Size), Link: 1, Info: 1, Addralign: 8, Entsize: elf.Sym64Size},
+	}
+
+	buffer := new(bytes.Buffer)
+	Expect(binary.Write(buffer, binary.LittleEndian, header)).To(Succeed())
+	buffer.Write(strtab)
+	Expect(binary.Write(buffer, binary.LittleEndian, syms)).To(Succeed())
+	Expect(binary.Write(buffer, binary.LittleEndian, sections)).To(Succeed())
+
+	Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(path, buffer.Bytes(), 0644)).To(Succeed())
+}
+
+// writeMachO writes a 64-bit Mach-O dylib header for cpu.
+func writeMachO(path string, cpu macho.Cpu) {
+	buffer := new(bytes.Buffer)
+	header := macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeDylib}
+	Expect(binary.Write(buffer, binary.LittleEndian, header)).To(Succeed())
+	Expect(binary.Write(buffer, binary.LittleEndian, uint32(0))).To(Succeed())
+
+	Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(path, buffer.Bytes(), 0644)).To(Succeed())
+}
+
+var _ = Describe("Addons", func() {
+	var (
+		err      error
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	Describe("Scan", func() {
+		It("returns nothing without node_modules", func() {
+			found, err := addons.Scan(buildDir, "amd64", "64")
+			Expect(err).To(BeNil())
+			Expect(found).To(BeEmpty())
+		})
+
+		It("reads the platform, architecture and ABI of linux addons", func() {
+			writeELF(filepath.Join(buildDir, "node_modules", "bcrypt", "build", "Release", "bcrypt_lib.node"), elf.EM_X86_64, "node_register_module_v64")
+			writeELF(filepath.Join(buildDir, "node_modules", "@scope", "napi", "build", "Release", "napi.node"), elf.EM_AARCH64, "napi_register_module_v1")
+			writeELF(filepath.Join(buildDir, "node_modules", "old", "build", "Release", "old.node"), elf.EM_X86_64)
+
+			found, err := addons.Scan(buildDir, "amd64", "64")
+			Expect(err).To(BeNil())
+			Expect(found).To(ConsistOf(
+				addons.Addon{Path: "node_modules/bcrypt/build/Release/bcrypt_lib.node", Package: "bcrypt", Platform: "linux", Arch: "amd64", ABI: "64"},
+				addons.Addon{Path: "node_modules/@scope/napi/build/Release/napi.node", Package: "@scope/napi", Platform: "linux", Arch: "arm64", ABI: "napi"},
+				addons.Addon{Path: "node_modules/old/build/Release/old.node", Package: "old", Platform: "linux", Arch: "amd64"},
+			))
+		})
+
+		It("recognises Mach-O and Windows addons", func() {
+			writeMachO(filepath.Join(buildDir, "node_modules", "bcrypt", "build", "Release", "bcrypt_lib.node"), macho.Cpu(0x0100000c))
+			path := filepath.Join(buildDir, "node_modules", "winonly", "build", "Release", "winonly.node")
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte("MZ\x90\x00"), 0644)).To(Succeed())
+
+			found, err := addons.Scan(buildDir, "amd64", "64")
+			Expect(err).To(BeNil())
+			Expect(found).To(ConsistOf(
+				addons.Addon{Path: "node_modules/bcrypt/build/Release/bcrypt_lib.node", Package: "bcrypt", Platform: "darwin", Arch: "arm64"},
+				addons.Addon{Path: "node_modules/winonly/build/Release/winonly.node", Package: "winonly", Platform: "windows", Arch: "unknown"},
+			))
+		})
+
+		It("takes the package from the innermost node_modules", func() {
+			writeELF(filepath.Join(buildDir, "node_modules", "outer", "node_modules", "inner", "inner.node"), elf.EM_X86_64)
+
+			found, err := addons.Scan(buildDir, "amd64", "64")
+			Expect(err).To(BeNil())
+			Expect(found).To(HaveLen(1))
+			Expect(found[0].Package).To(Equal("inner"))
+		})
+
+		It("skips prebuilt binaries for other platforms, architectures and ABIs", func() {
+			dir := filepath.Join(buildDir, "node_modules", "sharp")
+			writeMachO(filepath.Join(dir, "prebuilds", "darwin-x64", "sharp.node"), macho.CpuAmd64)
+			writeELF(filepath.Join(dir, "prebuilds", "linux-arm64", "sharp.node"), elf.EM_AARCH64)
+			writeELF(filepath.Join(dir, "prebuilds", "linux-x64-musl", "sharp.node"), elf.EM_X86_64)
+			writeELF(filepath.Join(dir, "lib", "binding", "node-v57-linux-x64", "sharp.node"), elf.EM_X86_64, "node_register_module_v57")
+			writeELF(filepath.Join(dir, "lib", "binding", "node-v64-linux-x64", "sharp.node"), elf.EM_X86_64, "node_register_module_v64")
+
+			found, err := addons.Scan(buildDir, "amd64", "64")
+			Expect(err).To(BeNil())
+			Expect(found).To(HaveLen(1))
+			Expect(found[0].Path).To(Equal("node_modules/sharp/lib/binding/node-v64-linux-x64/sharp.node"))
+		})
+	})
+
+	Describe("Problem", func() {
+		It("is empty for addons that load", func() {
+			Expect(addons.Addon{Platform: "linux", Arch: "amd64", ABI: "64"}.Problem("x64", "64")).To(Equal(""))
+			Expect(addons.Addon{Platform: "linux", Arch: "amd64", ABI: "napi"}.Problem("amd64", "72")).To(Equal(""))
+			Expect(addons.Addon{Platform: "linux", Arch: "amd64"}.Problem("amd64", "72")).To(Equal(""))
+		})
+
+		It("explains the platform, architecture or ABI mismatch", func() {
+			Expect(addons.Addon{Platform: "darwin", Arch: "arm64"}.Problem("amd64", "64")).To(Equal("built for darwin"))
+			Expect(addons.Addon{Platform: "linux", Arch: "arm64", ABI: "64"}.Problem("amd64", "64")).To(Equal("built for arm64"))
+			Expect(addons.Addon{Platform: "linux", Arch: "amd64", ABI: "57"}.Problem("amd64", "64")).To(Equal("built for NODE_MODULE_VERSION 57, node here uses 64"))
+		})
+	})
+
+	Describe("Table", func() {
+		It("lists each addon with its problem", func() {
+			table := addons.Table([]addons.Addon{
+				{Path: "node_modules/bcrypt/build/Release/bcrypt_lib.node", Package: "bcrypt", Platform: "darwin", Arch: "arm64"},
+			}, "amd64", "64")
+			Expect(table).To(Equal("PACKAGE  FILE                                               PROBLEM\n" +
+				"bcrypt   node_modules/bcrypt/build/Release/bcrypt_lib.node  built for darwin"))
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package arch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Default is the architecture of manifest entries without an arch field,
+// which were all built for x86-64.
+const Default = "amd64"
+
+// aliases maps the names the manifest, Node dists and uname use for an
+// architecture to Go's.
+var aliases = map[string]string{
+	"amd64":   "amd64",
+	"x64":     "amd64",
+	"x86_64":  "amd64",
+	"x86-64":  "amd64",
+	"arm64":   "arm64",
+	"aarch64": "arm64",
+	"386":     "386",
+	"ia32":    "386",
+	"arm":     "arm",
+}
+
+// Current returns the architecture staging runs on.
+func Current() string {
+	return runtime.GOARCH
+}
+
+// distNames maps an architecture to the name node dists and prebuilt
+// addons use for it.
+var distNames = map[string]string{
+	"amd64": "x64",
+	"386":   "ia32",
+	"arm64": "arm64",
+	"arm":   "arm",
+}
+
+// Dist returns the name node uses for an architecture, as in
+// node-v<version>-linux-<dist>.
+func Dist(name string) string {
+	name = Normalize(name)
+	if dist, found := distNames[name]; found {
+		return dist
+	}
+	return name
+}
+
+// Normalize returns Go's name for an architecture, so "x64" and "amd64"
+// compare equal. Unknown names are returned lowercased.
+func Normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return Default
+	}
+	if normalized, found := aliases[name]; found {
+		return normalized
+	}
+	return name
+}
+
+type entry struct {
+	URI  string `yaml:"uri"`
+	Arch string `yaml:"arch"`
+}
+
+type manifestFile struct {
+	Entries []entry `yaml:"dependencies"`
+}
+
+// Filter drops the manifest entries built for an architecture other than
+// arch, so the manifest's lookups only see the ones that run here.
+// libbuildpack does not read the arch field, so it is read again from
+// manifest.yml and every override.yml in depsDir, and matched to the
+// entries by uri. It returns the number of entries dropped, and fails if
+// none are left, so staging stops before it looks for node.
+func Filter(manifest *libbuildpack.Manifest, depsDir, arch string) (int, error) {
+	arches, err := entryArches(manifest, depsDir)
+	if err != nil {
+		return 0, err
+	}
+
+	arch = Normalize(arch)
+	kept := manifest.ManifestEntries[:0]
+	for _, e := range manifest.ManifestEntries {
+		if Normalize(arches[e.URI]) == arch {
+			kept = append(kept, e)
+		}
+	}
+
+	dropped := len(manifest.ManifestEntries) - len(kept)
+	if len(kept) == 0 && dropped > 0 {
+		return dropped, fmt.Errorf("no dependencies for %s in manifest.yml; add %s entries with an override.yml, or stage on an architecture the buildpack includes", arch, arch)
+	}
+	manifest.ManifestEntries = kept
+	return dropped, nil
+}
+
+func entryArches(manifest *libbuildpack.Manifest, depsDir string) (map[string]string, error) {
+	arches := map[string]string{}
+
+	var main manifestFile
+	if err := libbuildpack.NewYAML().Load(filepath.Join(manifest.RootDir(), "manifest.yml"), &main); err != nil {
+		return nil, err
+	}
+	for _, e := range main.Entries {
+		arches[e.URI] = e.Arch
+	}
+
+	overrides, err := filepath.Glob(filepath.Join(depsDir, "*", "override.yml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range overrides {
+		var override map[string]manifestFile
+		if err := libbuildpack.NewYAML().Load(path, &override); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, e := range override[manifest.Language()].Entries {
+			arches[e.URI] = e.Arch
+		}
+	}
+	return arches, nil
+}
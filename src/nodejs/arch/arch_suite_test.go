@@ -0,0 +1,13 @@
+package arch_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestArch(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Arch Suite")
+}
@@ -0,0 +1,132 @@
+package arch_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"nodejs/arch"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Arch", func() {
+	var (
+		err          error
+		buildpackDir string
+		depsDir      string
+		manifest     *libbuildpack.Manifest
+	)
+
+	BeforeEach(func() {
+		buildpackDir, err = ioutil.TempDir("", "nodejs-buildpack.buildpack.")
+		Expect(err).To(BeNil())
+		depsDir, err = ioutil.TempDir("", "nodejs-buildpack.deps.")
+		Expect(err).To(BeNil())
+
+		Expect(ioutil.WriteFile(filepath.Join(buildpackDir, "manifest.yml"), []byte(`---
+language: nodejs
+dependencies:
+- name: node
+  version: 10.16.0
+  uri: https://example.com/node-10.16.0-linux-x64.tgz
+- name: node
+  version: 10.16.0
+  uri: https://example.com/node-10.16.0-linux-arm64.tgz
+  arch: arm64
+- name: node
+  version: 10.15.0
+  uri: https://example.com/node-10.15.0-linux-x64.tgz
+  arch: x64
+`), 0644)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		logger := libbuildpack.NewLogger(ansicleaner.New(new(bytes.Buffer)))
+		manifest, err = libbuildpack.NewManifest(buildpackDir, logger, time.Now())
+		Expect(err).To(BeNil())
+		Expect(manifest.ApplyOverride(depsDir)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildpackDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	Describe("Normalize", func() {
+		It("uses Go's names", func() {
+			Expect(arch.Normalize("x64")).To(Equal("amd64"))
+			Expect(arch.Normalize("x86_64")).To(Equal("amd64"))
+			Expect(arch.Normalize("AArch64")).To(Equal("arm64"))
+			Expect(arch.Normalize("ppc64le")).To(Equal("ppc64le"))
+		})
+
+		It("treats a missing arch as amd64", func() {
+			Expect(arch.Normalize("")).To(Equal("amd64"))
+		})
+	})
+
+	Describe("Dist", func() {
+		It("uses node's names", func() {
+			Expect(arch.Dist("amd64")).To(Equal("x64"))
+			Expect(arch.Dist("aarch64")).To(Equal("arm64"))
+			Expect(arch.Dist("386")).To(Equal("ia32"))
+		})
+	})
+
+	Describe("Filter", func() {
+		It("keeps entries without an arch on amd64", func() {
+			dropped, err := arch.Filter(manifest, depsDir, "amd64")
+			Expect(err).To(BeNil())
+			Expect(dropped).To(Equal(1))
+			Expect(manifest.AllDependencyVersions("node")).To(Equal([]string{"10.16.0", "10.15.0"}))
+		})
+
+		It("keeps only arm64 entries on arm64", func() {
+			dropped, err := arch.Filter(manifest, depsDir, "arm64")
+			Expect(err).To(BeNil())
+			Expect(dropped).To(Equal(2))
+			Expect(manifest.ManifestEntries).To(HaveLen(1))
+			Expect(manifest.ManifestEntries[0].URI).To(Equal("https://example.com/node-10.16.0-linux-arm64.tgz"))
+		})
+
+		It("fails when no entry is built for the architecture", func() {
+			_, err := arch.Filter(manifest, depsDir, "ppc64le")
+			Expect(err).To(MatchError("no dependencies for ppc64le in manifest.yml; add ppc64le entries with an override.yml, or stage on an architecture the buildpack includes"))
+			Expect(manifest.ManifestEntries).To(HaveLen(3))
+		})
+
+		It("fails on arm64 with the buildpack's manifest.yml, which has no arm64 entries yet", func() {
+			logger := libbuildpack.NewLogger(ansicleaner.New(new(bytes.Buffer)))
+			manifest, err := libbuildpack.NewManifest(filepath.Join("..", "..", ".."), logger, time.Now())
+			Expect(err).To(BeNil())
+
+			_, err = arch.Filter(manifest, depsDir, "arm64")
+			Expect(err).To(MatchError(ContainSubstring("no dependencies for arm64 in manifest.yml")))
+		})
+
+		Context("an override.yml adds entries", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(depsDir, "0"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(depsDir, "0", "override.yml"), []byte(`---
+nodejs:
+  dependencies:
+  - name: node
+    version: 12.0.0
+    uri: https://mirror.example.com/node-12.0.0-linux-arm64.tgz
+    arch: aarch64
+`), 0644)).To(Succeed())
+			})
+
+			It("reads their arch as well", func() {
+				_, err := arch.Filter(manifest, depsDir, "arm64")
+				Expect(err).To(BeNil())
+				Expect(manifest.AllDependencyVersions("node")).To(Equal([]string{"10.16.0", "12.0.0"}))
+			})
+		})
+	})
+})
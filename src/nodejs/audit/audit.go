@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"nodejs/config"
+	"nodejs/inventory"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Masterminds/semver"
+)
+
+var severities = map[string]int{
+	"low":      1,
+	"moderate": 2,
+	"high":     3,
+	"critical": 4,
+}
+
+// Policy decides which findings fail staging: those at or above Level, a
+// severity or "none", unless their advisory id is ignored.
+type Policy struct {
+	Level  string
+	Ignore []string
+}
+
+// Finding is an installed package matched by an advisory.
+type Finding struct {
+	Package  inventory.Package
+	Advisory Advisory
+}
+
+// NewPolicy reads the audit section of buildpack.yml, overridden by the
+// NODE_AUDIT_LEVEL and NODE_AUDIT_IGNORE env vars. The level defaults to high.
+func NewPolicy(fromFile config.Audit) (Policy, error) {
+	policy := Policy{Level: fromFile.Level, Ignore: fromFile.Ignore}
+
+	if level, found := os.LookupEnv("NODE_AUDIT_LEVEL"); found {
+		policy.Level = strings.ToLower(level)
+	}
+	if ignore, found := os.LookupEnv("NODE_AUDIT_IGNORE"); found {
+		policy.Ignore = nil
+		for _, id := range strings.Split(ignore, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				policy.Ignore = append(policy.Ignore, id)
+			}
+		}
+	}
+
+	if policy.Level == "" {
+		policy.Level = "high"
+	}
+	if _, found := severities[policy.Level]; !found && policy.Level != "none" {
+		return Policy{}, fmt.Errorf("audit level must be low, moderate, high, critical or none, not %s", policy.Level)
+	}
+	return policy, nil
+}
+
+func (p Policy) Ignores(f Finding) bool {
+	for _, id := range p.Ignore {
+		if strings.EqualFold(id, f.Advisory.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) Fails(f Finding) bool {
+	return p.Level != "none" && severities[f.Advisory.Severity] >= severities[p.Level] && !p.Ignores(f)
+}
+
+// Check matches packages against the database, most severe findings first.
+// Packages whose version is not semver, like git dependencies, never match.
+func (d Database) Check(packages []inventory.Package) []Finding {
+	byPackage := map[string][]Advisory{}
+	for _, advisory := range d.Advisories {
+		byPackage[advisory.Package] = append(byPackage[advisory.Package], advisory)
+	}
+
+	var findings []Finding
+	for _, pkg := range packages {
+		advisories := byPackage[pkg.Name]
+		if len(advisories) == 0 {
+			continue
+		}
+		version, err := semver.NewVersion(pkg.Version)
+		if err != nil {
+			continue
+		}
+		for _, advisory := range advisories {
+			if advisory.vulnerable.Check(version) {
+				findings = append(findings, Finding{Package: pkg, Advisory: advisory})
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severities[findings[i].Advisory.Severity] > severities[findings[j].Advisory.Severity]
+	})
+	return findings
+}
+
+// Table lays findings out in columns for the staging log.
+func Table(findings []Finding) string {
+	buffer := new(bytes.Buffer)
+	table := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SEVERITY\tPACKAGE\tADVISORY\tTITLE")
+	for _, f := range findings {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", f.Advisory.Severity, f.Package.ID(), f.Advisory.ID, f.Advisory.Title)
+	}
+	table.Flush()
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
@@ -0,0 +1,167 @@
+package audit_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"nodejs/audit"
+	"nodejs/config"
+	"nodejs/inventory"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit", func() {
+	var (
+		err          error
+		buildpackDir string
+		depsDir      string
+	)
+
+	BeforeEach(func() {
+		buildpackDir, err = ioutil.TempDir("", "nodejs-buildpack.buildpack.")
+		Expect(err).To(BeNil())
+		depsDir, err = ioutil.TempDir("", "nodejs-buildpack.deps.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildpackDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+		Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+	})
+
+	writeDatabase := func(dir, contents string) {
+		Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "advisories.json"), []byte(contents), 0644)).To(Succeed())
+	}
+
+	const lodash = `{"advisories": [{"id": "GHSA-jf85-cpcp-j695", "package": "lodash", "vulnerable_versions": "<4.17.12", "severity": "high", "title": "Prototype Pollution in lodash"}]}`
+
+	Describe("Load", func() {
+		It("finds nothing without a database", func() {
+			db, err := audit.Load(buildpackDir, depsDir)
+			Expect(err).To(BeNil())
+			Expect(db.Sources).To(BeEmpty())
+		})
+
+		It("merges the buildpack's and the deps dirs' databases, later ones winning", func() {
+			writeDatabase(buildpackDir, lodash)
+			writeDatabase(filepath.Join(depsDir, "0"), `{"advisories": [
+				{"id": "GHSA-jf85-cpcp-j695", "package": "lodash", "vulnerable_versions": "<4.17.12", "severity": "critical"},
+				{"id": "GHSA-c9g6-9335-x697", "package": "minimist", "vulnerable_versions": "<0.2.1", "severity": "low"}
+			]}`)
+
+			db, err := audit.Load(buildpackDir, depsDir)
+			Expect(err).To(BeNil())
+			Expect(db.Sources).To(Equal([]string{filepath.Join(buildpackDir, "advisories.json"), filepath.Join(depsDir, "0", "advisories.json")}))
+			Expect(db.Advisories).To(HaveLen(2))
+			Expect(db.Advisories[0].Severity).To(Equal("critical"))
+		})
+
+		It("reads advisories inline from a bound service", func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{"user-provided": [{"name": "advisory-db", "credentials": `+lodash+`}]}`)).To(Succeed())
+			db, err := audit.Load(buildpackDir, depsDir)
+			Expect(err).To(BeNil())
+			Expect(db.Sources).To(Equal([]string{"service advisory-db"}))
+			Expect(db.Advisories[0].ID).To(Equal("GHSA-jf85-cpcp-j695"))
+		})
+
+		It("downloads advisories from a bound service's uri", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(lodash))
+			}))
+			defer server.Close()
+
+			Expect(os.Setenv("VCAP_SERVICES", `{"internal-db": [{"name": "vulns", "tags": ["advisory"], "credentials": {"uri": "`+server.URL+`"}}]}`)).To(Succeed())
+			db, err := audit.Load(buildpackDir, depsDir)
+			Expect(err).To(BeNil())
+			Expect(db.Advisories).To(HaveLen(1))
+		})
+
+		It("rejects advisories with an unknown severity", func() {
+			writeDatabase(buildpackDir, `{"advisories": [{"id": "X-1", "package": "lodash", "vulnerable_versions": "<1.0.0", "severity": "severe"}]}`)
+			_, err := audit.Load(buildpackDir, depsDir)
+			Expect(err).To(MatchError(ContainSubstring(`advisory X-1 has unknown severity "severe"`)))
+		})
+	})
+
+	Describe("Check", func() {
+		DescribeTable("matching vulnerable versions",
+			func(vulnerable, version string, matches bool) {
+				writeDatabase(buildpackDir, `{"advisories": [{"id": "X-1", "package": "pkg", "vulnerable_versions": "`+vulnerable+`", "severity": "moderate"}]}`)
+				db, err := audit.Load(buildpackDir, depsDir)
+				Expect(err).To(BeNil())
+				Expect(db.Check([]inventory.Package{{Name: "pkg", Version: version}})).To(HaveLen(map[bool]int{true: 1, false: 0}[matches]))
+			},
+			Entry("below", "<4.17.12", "4.17.11", true),
+			Entry("fixed", "<4.17.12", "4.17.12", false),
+			Entry("npm style range", ">=4.0.0 <4.1.0", "4.0.5", true),
+			Entry("GitHub style range", ">= 4.0.0, < 4.1.0", "4.1.0", false),
+			Entry("either range", "<1.0.0 || >=2.0.0 <2.0.3", "2.0.1", true),
+			Entry("not a semver version", "<1.0.0", "github:user/pkg", false),
+		)
+
+		It("lists the most severe findings first", func() {
+			writeDatabase(buildpackDir, `{"advisories": [
+				{"id": "X-1", "package": "a", "vulnerable_versions": "*", "severity": "low"},
+				{"id": "X-2", "package": "b", "vulnerable_versions": "*", "severity": "critical"}
+			]}`)
+			db, err := audit.Load(buildpackDir, depsDir)
+			Expect(err).To(BeNil())
+
+			findings := db.Check([]inventory.Package{{Name: "a", Version: "1.0.0"}, {Name: "b", Version: "1.0.0"}, {Name: "c", Version: "1.0.0"}})
+			Expect(findings).To(HaveLen(2))
+			Expect(audit.Table(findings)).To(Equal(
+				"SEVERITY  PACKAGE  ADVISORY  TITLE\n" +
+					"critical  b@1.0.0  X-2       \n" +
+					"low       a@1.0.0  X-1       "))
+		})
+	})
+
+	Describe("Policy", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("NODE_AUDIT_LEVEL")).To(Succeed())
+			Expect(os.Unsetenv("NODE_AUDIT_IGNORE")).To(Succeed())
+		})
+
+		finding := func(id, severity string) audit.Finding {
+			return audit.Finding{Advisory: audit.Advisory{ID: id, Severity: severity}}
+		}
+
+		It("fails on high and critical findings by default", func() {
+			policy, err := audit.NewPolicy(config.Audit{})
+			Expect(err).To(BeNil())
+			Expect(policy.Fails(finding("X-1", "moderate"))).To(BeFalse())
+			Expect(policy.Fails(finding("X-1", "high"))).To(BeTrue())
+			Expect(policy.Fails(finding("X-1", "critical"))).To(BeTrue())
+		})
+
+		It("lets env vars override buildpack.yml", func() {
+			Expect(os.Setenv("NODE_AUDIT_LEVEL", "Low")).To(Succeed())
+			Expect(os.Setenv("NODE_AUDIT_IGNORE", "X-1, X-2")).To(Succeed())
+			policy, err := audit.NewPolicy(config.Audit{Level: "critical", Ignore: []string{"X-3"}})
+			Expect(err).To(BeNil())
+			Expect(policy).To(Equal(audit.Policy{Level: "low", Ignore: []string{"X-1", "X-2"}}))
+			Expect(policy.Ignores(finding("x-2", "low"))).To(BeTrue())
+			Expect(policy.Fails(finding("X-2", "critical"))).To(BeFalse())
+			Expect(policy.Fails(finding("X-3", "low"))).To(BeTrue())
+		})
+
+		It("never fails at level none", func() {
+			policy, err := audit.NewPolicy(config.Audit{Level: "none"})
+			Expect(err).To(BeNil())
+			Expect(policy.Fails(finding("X-1", "critical"))).To(BeFalse())
+		})
+
+		It("rejects unknown levels", func() {
+			Expect(os.Setenv("NODE_AUDIT_LEVEL", "severe")).To(Succeed())
+			_, err := audit.NewPolicy(config.Audit{})
+			Expect(err).To(MatchError("audit level must be low, moderate, high, critical or none, not severe"))
+		})
+	})
+})
@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Filename is the advisory database's name in the buildpack and in deps dirs.
+const Filename = "advisories.json"
+
+// Advisory is a known vulnerability in the versions of a package matching
+// VulnerableVersions, an npm style range such as ">=4.0.0 <4.17.12".
+type Advisory struct {
+	ID                 string `json:"id"`
+	Package            string `json:"package"`
+	VulnerableVersions string `json:"vulnerable_versions"`
+	Severity           string `json:"severity"`
+	Title              string `json:"title"`
+	URL                string `json:"url"`
+
+	vulnerable *semver.Constraints
+}
+
+// Database holds the advisories from every source found.
+type Database struct {
+	Advisories []Advisory
+	// Sources names where the advisories came from, in the order read.
+	Sources []string
+}
+
+type databaseFile struct {
+	Advisories []Advisory `json:"advisories"`
+}
+
+// Load merges the advisory databases shipped in buildpackDir, left in any
+// deps dir by an earlier buildpack, and bound as a service whose name, label
+// or tags mention "advisory". The service's credentials either hold the
+// advisories inline or a uri to fetch them from. Later sources replace
+// advisories with the same id.
+func Load(buildpackDir, depsDir string) (Database, error) {
+	var db Database
+	byID := map[string]int{}
+
+	merge := func(source string, file databaseFile) error {
+		for _, advisory := range file.Advisories {
+			if err := advisory.parse(); err != nil {
+				return fmt.Errorf("%s: %s", source, err)
+			}
+			if idx, found := byID[advisory.ID]; found {
+				db.Advisories[idx] = advisory
+			} else {
+				byID[advisory.ID] = len(db.Advisories)
+				db.Advisories = append(db.Advisories, advisory)
+			}
+		}
+		db.Sources = append(db.Sources, source)
+		return nil
+	}
+
+	paths := []string{filepath.Join(buildpackDir, Filename)}
+	if dirs, err := ioutil.ReadDir(depsDir); err == nil {
+		for _, dir := range dirs {
+			if dir.IsDir() {
+				paths = append(paths, filepath.Join(depsDir, dir.Name(), Filename))
+			}
+		}
+	}
+	for _, path := range paths {
+		var file databaseFile
+		if err := libbuildpack.NewJSON().Load(path, &file); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return Database{}, fmt.Errorf("%s: %s", path, err)
+		}
+		if err := merge(path, file); err != nil {
+			return Database{}, err
+		}
+	}
+
+	name, file, err := fromService()
+	if err != nil {
+		return Database{}, err
+	}
+	if name != "" {
+		if err := merge("service "+name, file); err != nil {
+			return Database{}, err
+		}
+	}
+
+	return db, nil
+}
+
+func fromService() (string, databaseFile, error) {
+	var vcapServices map[string][]struct {
+		Name        string          `json:"name"`
+		Label       string          `json:"label"`
+		Tags        []string        `json:"tags"`
+		Credentials json.RawMessage `json:"credentials"`
+	}
+	if err := json.Unmarshal([]byte(os.Getenv("VCAP_SERVICES")), &vcapServices); err != nil {
+		return "", databaseFile{}, nil
+	}
+
+	for _, services := range vcapServices {
+		for _, service := range services {
+			if !strings.Contains(strings.Join(append([]string{service.Name, service.Label}, service.Tags...), " "), "advisory") {
+				continue
+			}
+
+			var credentials struct {
+				databaseFile
+				URI string `json:"uri"`
+			}
+			if err := json.Unmarshal(service.Credentials, &credentials); err != nil {
+				return "", databaseFile{}, fmt.Errorf("service %s: %s", service.Name, err)
+			}
+			if credentials.URI == "" {
+				return service.Name, credentials.databaseFile, nil
+			}
+
+			file, err := fetch(credentials.URI)
+			if err != nil {
+				return "", databaseFile{}, fmt.Errorf("service %s: %s", service.Name, err)
+			}
+			return service.Name, file, nil
+		}
+	}
+	return "", databaseFile{}, nil
+}
+
+func fetch(uri string) (databaseFile, error) {
+	var file databaseFile
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(uri)
+	if err != nil {
+		return file, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return file, fmt.Errorf("could not download %s: %s", uri, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&file)
+	return file, err
+}
+
+func (a *Advisory) parse() error {
+	if a.ID == "" || a.Package == "" {
+		return fmt.Errorf("advisory %q needs an id and a package", a.ID)
+	}
+
+	a.Severity = strings.ToLower(a.Severity)
+	if a.Severity == "medium" {
+		a.Severity = "moderate"
+	}
+	if severities[a.Severity] == 0 {
+		return fmt.Errorf("advisory %s has unknown severity %q", a.ID, a.Severity)
+	}
+
+	var err error
+	if a.vulnerable, err = semver.NewConstraint(npmRange(a.VulnerableVersions)); err != nil {
+		return fmt.Errorf("advisory %s has invalid vulnerable_versions %q: %s", a.ID, a.VulnerableVersions, err)
+	}
+	return nil
+}
+
+var operatorSpace = regexp.MustCompile(`([<>=~^]+)\s+`)
+
+// npmRange rewrites the space separated comparators npm and GitHub
+// advisories use, ">= 1.0.0 < 1.2.3", into the comma separated form semver
+// expects.
+func npmRange(spec string) string {
+	alternatives := strings.Split(spec, "||")
+	for i, alternative := range alternatives {
+		if strings.Contains(alternative, " - ") {
+			continue
+		}
+		comparators := strings.FieldsFunc(operatorSpace.ReplaceAllString(alternative, "$1"), func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+		alternatives[i] = strings.Join(comparators, ",")
+	}
+	return strings.Join(alternatives, "||")
+}
@@ -0,0 +1,236 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Filename is the name operators give a CA file in a deps dir.
+	Filename = "ca-certificates.pem"
+	// ExtraFile holds the extra CAs in the dep dir, for NODE_EXTRA_CA_CERTS.
+	ExtraFile = "ca-certs/extra.pem"
+	// BundleFile holds the system CAs followed by the extra ones, for tools
+	// such as npm whose cafile replaces the CAs they trust by default.
+	BundleFile = "ca-certs/bundle.pem"
+)
+
+// systemBundles are where Linux distributions keep their CA bundle.
+var systemBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+}
+
+// Trust is the TLS trust staging was configured with.
+type Trust struct {
+	// Sources names where extra CAs came from, empty when there were none.
+	Sources []string
+	// Count is the number of extra CA certificates.
+	Count    int
+	Insecure bool
+}
+
+// Configure trusts the extra CAs found in NODE_CA_CERTS, in services whose
+// name, label or tags contain "ca-certs" and in Filename in any deps dir. It
+// writes them to depDir, points the Go HTTP clients used for downloads and
+// hooks at them, and sets NODE_EXTRA_CA_CERTS and the npm and yarn cafile
+// settings for the rest of staging.
+//
+// Certificate verification is only switched off when NODE_TLS_INSECURE is
+// true.
+func Configure(depsDir, depDir string) (Trust, error) {
+	var trust Trust
+
+	if insecure := os.Getenv("NODE_TLS_INSECURE"); insecure != "" {
+		var err error
+		if trust.Insecure, err = strconv.ParseBool(insecure); err != nil {
+			return Trust{}, fmt.Errorf("NODE_TLS_INSECURE must be true or false, not %s", insecure)
+		}
+	}
+
+	extra, sources, err := load(depsDir)
+	if err != nil {
+		return Trust{}, err
+	}
+	trust.Sources = sources
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, cert := range extra {
+		pool.AddCert(cert)
+	}
+	trust.Count = len(extra)
+
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, InsecureSkipVerify: trust.Insecure}
+	}
+
+	env := map[string]string{}
+	if len(extra) > 0 {
+		if err := write(depDir, extra); err != nil {
+			return Trust{}, err
+		}
+		env["NODE_EXTRA_CA_CERTS"] = filepath.Join(depDir, ExtraFile)
+		env["NPM_CONFIG_CAFILE"] = filepath.Join(depDir, BundleFile)
+		env["YARN_CA_FILE_PATH"] = filepath.Join(depDir, BundleFile)
+	}
+	if trust.Insecure {
+		env["NODE_TLS_REJECT_UNAUTHORIZED"] = "0"
+		env["NPM_CONFIG_STRICT_SSL"] = "false"
+		env["YARN_ENABLE_STRICT_SSL"] = "false"
+	}
+	for name, value := range env {
+		if err := os.Setenv(name, value); err != nil {
+			return Trust{}, err
+		}
+	}
+
+	return trust, nil
+}
+
+func load(depsDir string) ([]*x509.Certificate, []string, error) {
+	var certs []*x509.Certificate
+	var sources []string
+
+	add := func(source string, contents []byte) error {
+		parsed, err := parse(contents)
+		if err != nil {
+			return fmt.Errorf("%s: %s", source, err)
+		}
+		certs = append(certs, parsed...)
+		sources = append(sources, source)
+		return nil
+	}
+
+	if fromEnv := os.Getenv("NODE_CA_CERTS"); fromEnv != "" {
+		if err := add("NODE_CA_CERTS", []byte(fromEnv)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	services, err := fromServices()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, service := range services {
+		if err := add("service "+service.name, []byte(service.certificates)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if dirs, err := ioutil.ReadDir(depsDir); err == nil {
+		for _, dir := range dirs {
+			path := filepath.Join(depsDir, dir.Name(), Filename)
+			contents, err := ioutil.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, nil, err
+			}
+			if err := add(path, contents); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return certs, sources, nil
+}
+
+type service struct {
+	name         string
+	certificates string
+}
+
+func fromServices() ([]service, error) {
+	var vcapServices map[string][]struct {
+		Name        string   `json:"name"`
+		Label       string   `json:"label"`
+		Tags        []string `json:"tags"`
+		Credentials struct {
+			Certificates string `json:"certificates"`
+		} `json:"credentials"`
+	}
+	if err := json.Unmarshal([]byte(os.Getenv("VCAP_SERVICES")), &vcapServices); err != nil {
+		return nil, nil
+	}
+
+	var services []service
+	for _, instances := range vcapServices {
+		for _, instance := range instances {
+			if !strings.Contains(strings.Join(append([]string{instance.Name, instance.Label}, instance.Tags...), " "), "ca-certs") {
+				continue
+			}
+			if instance.Credentials.Certificates == "" {
+				return nil, fmt.Errorf("service %s has no certificates in its credentials", instance.Name)
+			}
+			services = append(services, service{name: instance.Name, certificates: instance.Credentials.Certificates})
+		}
+	}
+	return services, nil
+}
+
+// parse reads every certificate in PEM data, which must hold at least one.
+func parse(contents []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificates found")
+	}
+	return certs, nil
+}
+
+func write(depDir string, extra []*x509.Certificate) error {
+	buffer := new(bytes.Buffer)
+	for _, cert := range extra {
+		if err := pem.Encode(buffer, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(depDir, filepath.Dir(ExtraFile)), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(depDir, ExtraFile), buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	var bundle []byte
+	for _, path := range append([]string{os.Getenv("SSL_CERT_FILE")}, systemBundles...) {
+		if path == "" {
+			continue
+		}
+		if contents, err := ioutil.ReadFile(path); err == nil {
+			bundle = append(contents, '\n')
+			break
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(depDir, BundleFile), append(bundle, buffer.Bytes()...), 0644)
+}
@@ -0,0 +1,114 @@
+package certs_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"nodejs/certs"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Certs", func() {
+	var (
+		err     error
+		depsDir string
+		depDir  string
+		server  *httptest.Server
+		caPEM   string
+	)
+
+	BeforeEach(func() {
+		depsDir, err = ioutil.TempDir("", "nodejs-buildpack.deps.")
+		Expect(err).To(BeNil())
+		depDir = filepath.Join(depsDir, "0")
+		Expect(os.MkdirAll(depDir, 0755)).To(Succeed())
+
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		caPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		transport := http.DefaultTransport.(*http.Transport)
+		transport.TLSClientConfig = nil
+		transport.CloseIdleConnections()
+
+		for _, env := range []string{"NODE_CA_CERTS", "NODE_TLS_INSECURE", "VCAP_SERVICES", "NODE_EXTRA_CA_CERTS", "NPM_CONFIG_CAFILE", "YARN_CA_FILE_PATH", "NODE_TLS_REJECT_UNAUTHORIZED", "NPM_CONFIG_STRICT_SSL", "YARN_ENABLE_STRICT_SSL"} {
+			Expect(os.Unsetenv(env)).To(Succeed())
+		}
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	get := func() error {
+		resp, err := http.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	It("verifies certificates against the system CAs by default", func() {
+		trust, err := certs.Configure(depsDir, depDir)
+		Expect(err).To(BeNil())
+		Expect(trust).To(Equal(certs.Trust{}))
+		Expect(get()).To(MatchError(ContainSubstring("certificate")))
+		Expect(filepath.Join(depDir, certs.ExtraFile)).NotTo(BeAnExistingFile())
+		Expect(os.Getenv("NPM_CONFIG_CAFILE")).To(Equal(""))
+	})
+
+	It("trusts CAs from NODE_CA_CERTS", func() {
+		Expect(os.Setenv("NODE_CA_CERTS", caPEM)).To(Succeed())
+		trust, err := certs.Configure(depsDir, depDir)
+		Expect(err).To(BeNil())
+		Expect(trust).To(Equal(certs.Trust{Sources: []string{"NODE_CA_CERTS"}, Count: 1}))
+		Expect(get()).To(Succeed())
+
+		Expect(ioutil.ReadFile(filepath.Join(depDir, certs.ExtraFile))).To(Equal([]byte(caPEM)))
+		Expect(ioutil.ReadFile(filepath.Join(depDir, certs.BundleFile))).To(HaveSuffix(caPEM))
+		Expect(os.Getenv("NODE_EXTRA_CA_CERTS")).To(Equal(filepath.Join(depDir, certs.ExtraFile)))
+		Expect(os.Getenv("NPM_CONFIG_CAFILE")).To(Equal(filepath.Join(depDir, certs.BundleFile)))
+		Expect(os.Getenv("YARN_CA_FILE_PATH")).To(Equal(filepath.Join(depDir, certs.BundleFile)))
+	})
+
+	It("trusts CAs from bound services and deps dirs", func() {
+		Expect(os.Setenv("VCAP_SERVICES", `{"user-provided": [{"name": "corp-ca-certs", "credentials": {"certificates": `+jsonString(caPEM)+`}}]}`)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(depsDir, "1"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(depsDir, "1", certs.Filename), []byte(caPEM), 0644)).To(Succeed())
+
+		trust, err := certs.Configure(depsDir, depDir)
+		Expect(err).To(BeNil())
+		Expect(trust.Sources).To(Equal([]string{"service corp-ca-certs", filepath.Join(depsDir, "1", certs.Filename)}))
+		Expect(trust.Count).To(Equal(2))
+	})
+
+	It("rejects sources without certificates", func() {
+		Expect(os.Setenv("NODE_CA_CERTS", "not a certificate")).To(Succeed())
+		_, err := certs.Configure(depsDir, depDir)
+		Expect(err).To(MatchError("NODE_CA_CERTS: no PEM encoded certificates found"))
+	})
+
+	It("only skips verification when NODE_TLS_INSECURE is set", func() {
+		Expect(os.Setenv("NODE_TLS_INSECURE", "true")).To(Succeed())
+		trust, err := certs.Configure(depsDir, depDir)
+		Expect(err).To(BeNil())
+		Expect(trust.Insecure).To(BeTrue())
+		Expect(get()).To(Succeed())
+		Expect(os.Getenv("NPM_CONFIG_STRICT_SSL")).To(Equal("false"))
+		Expect(os.Getenv("NODE_TLS_REJECT_UNAUTHORIZED")).To(Equal("0"))
+
+		Expect(os.Setenv("NODE_TLS_INSECURE", "maybe")).To(Succeed())
+		_, err = certs.Configure(depsDir, depDir)
+		Expect(err).To(MatchError("NODE_TLS_INSECURE must be true or false, not maybe"))
+	})
+})
+
+func jsonString(s string) string {
+	contents, _ := json.Marshal(s)
+	return string(contents)
+}
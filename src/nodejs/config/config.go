@@ -0,0 +1,297 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Hooks lists the hooks that can be switched off under nodejs.hooks.
+var Hooks = []string{"appdynamics", "dynatrace", "newrelic", "seeker", "snyk"}
+
+var keys = []string{
+	"audit",
+	"build_scripts",
+	"hooks",
+	"license_policy",
+	"node_modules_cache",
+	"npm_version",
+	"optimize_memory",
+	"pnpm_version",
+	"prune_dev_dependencies",
+	"run_build",
+	"start_command",
+	"verbose",
+	"version",
+	"workspace",
+	"yarn_version",
+}
+
+// Config holds the nodejs section of buildpack.yml. Boolean settings are
+// pointers so an unset key can be told apart from an explicit false.
+type Config struct {
+	Version          string
+	NPMVersion       string
+	YarnVersion      string
+	PNPMVersion      string
+	StartCommand     string
+	BuildScripts     []string
+	NodeModulesCache *bool
+	Verbose          *bool
+	OptimizeMemory   *bool
+	RunBuild         *bool
+	PruneDevDeps     *bool
+	Workspace        string
+	Hooks            map[string]bool
+	LicensePolicy    LicensePolicy
+	Audit            Audit
+}
+
+// LicensePolicy lists SPDX license identifiers that dependencies may or may
+// not use, and whether a violation fails staging or only warns.
+type LicensePolicy struct {
+	Allow  []string
+	Deny   []string
+	Action string
+}
+
+// Audit sets the lowest advisory severity that fails staging, and advisories
+// to ignore.
+type Audit struct {
+	Level  string
+	Ignore []string
+}
+
+// Load reads the nodejs section of buildDir/buildpack.yml. A missing file
+// yields an empty Config. Other top level keys belong to other buildpacks
+// and are ignored, but unknown keys under nodejs are an error.
+func Load(buildDir string) (Config, error) {
+	var c Config
+	var raw map[string]interface{}
+
+	if err := libbuildpack.NewYAML().Load(filepath.Join(buildDir, "buildpack.yml"), &raw); err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return c, fmt.Errorf("buildpack.yml: %s", err)
+	}
+
+	section, found := raw["nodejs"]
+	if !found || section == nil {
+		return c, nil
+	}
+
+	settings, ok := section.(map[interface{}]interface{})
+	if !ok {
+		return c, fmt.Errorf("buildpack.yml: nodejs must be a map of settings")
+	}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, fmt.Sprint(name))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := settings[name]
+		var err error
+
+		switch name {
+		case "version":
+			c.Version, err = toVersion(name, value)
+		case "npm_version":
+			c.NPMVersion, err = toVersion(name, value)
+		case "yarn_version":
+			c.YarnVersion, err = toVersion(name, value)
+		case "pnpm_version":
+			c.PNPMVersion, err = toVersion(name, value)
+		case "start_command":
+			c.StartCommand, err = toString(name, value)
+		case "workspace":
+			c.Workspace, err = toString(name, value)
+		case "build_scripts":
+			c.BuildScripts, err = toStrings(name, value)
+		case "node_modules_cache":
+			c.NodeModulesCache, err = toBool(name, value)
+		case "verbose":
+			c.Verbose, err = toBool(name, value)
+		case "optimize_memory":
+			c.OptimizeMemory, err = toBool(name, value)
+		case "run_build":
+			c.RunBuild, err = toBool(name, value)
+		case "prune_dev_dependencies":
+			c.PruneDevDeps, err = toBool(name, value)
+		case "hooks":
+			c.Hooks, err = toHooks(value)
+		case "license_policy":
+			c.LicensePolicy, err = toLicensePolicy(value)
+		case "audit":
+			c.Audit, err = toAudit(value)
+		default:
+			err = fmt.Errorf("unknown key nodejs.%s (valid keys: %s)", name, strings.Join(keys, ", "))
+		}
+
+		if err != nil {
+			return Config{}, fmt.Errorf("buildpack.yml: %s", err)
+		}
+	}
+
+	return c, nil
+}
+
+// HookEnabled reports whether buildpack.yml leaves the named hook switched
+// on. Hooks are on unless explicitly set to false.
+func HookEnabled(buildDir, name string) (bool, error) {
+	c, err := Load(buildDir)
+	if err != nil {
+		return false, err
+	}
+
+	enabled, found := c.Hooks[name]
+	return !found || enabled, nil
+}
+
+func toString(name string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int, float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("nodejs.%s must be a string", name)
+}
+
+// toVersion accepts a whole major version such as 18 unquoted, but not a
+// float: YAML reads an unquoted 18.10 as the number 18.1, which would select
+// a different version.
+func toVersion(name string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int:
+		return fmt.Sprint(v), nil
+	case float64:
+		return "", fmt.Errorf("nodejs.%s must be quoted, YAML reads it as the number %v", name, v)
+	}
+	return "", fmt.Errorf("nodejs.%s must be a string", name)
+}
+
+func toStrings(name string, value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("nodejs.%s must be a list of strings", name)
+	}
+
+	strs := make([]string, 0, len(list))
+	for _, item := range list {
+		str, ok := item.(string)
+		if !ok || str == "" {
+			return nil, fmt.Errorf("nodejs.%s must be a list of strings", name)
+		}
+		strs = append(strs, str)
+	}
+	return strs, nil
+}
+
+func toBool(name string, value interface{}) (*bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("nodejs.%s must be true or false", name)
+	}
+	return &b, nil
+}
+
+func toHooks(value interface{}) (map[string]bool, error) {
+	settings, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("nodejs.hooks must map hook names to true or false")
+	}
+
+	hooks := map[string]bool{}
+	for key, setting := range settings {
+		name := fmt.Sprint(key)
+		if !knownHook(name) {
+			return nil, fmt.Errorf("unknown hook nodejs.hooks.%s (valid hooks: %s)", name, strings.Join(Hooks, ", "))
+		}
+
+		enabled, ok := setting.(bool)
+		if !ok {
+			return nil, fmt.Errorf("nodejs.hooks.%s must be true or false", name)
+		}
+		hooks[name] = enabled
+	}
+	return hooks, nil
+}
+
+func toLicensePolicy(value interface{}) (LicensePolicy, error) {
+	var policy LicensePolicy
+
+	settings, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return policy, fmt.Errorf("nodejs.license_policy must be a map of settings")
+	}
+
+	for key, setting := range settings {
+		var err error
+		switch name := fmt.Sprint(key); name {
+		case "allow":
+			policy.Allow, err = toStrings("license_policy.allow", setting)
+		case "deny":
+			policy.Deny, err = toStrings("license_policy.deny", setting)
+		case "action":
+			if policy.Action, err = toString("license_policy.action", setting); err == nil && policy.Action != "warn" && policy.Action != "fail" {
+				err = fmt.Errorf("nodejs.license_policy.action must be warn or fail")
+			}
+		default:
+			err = fmt.Errorf("unknown key nodejs.license_policy.%s (valid keys: action, allow, deny)", name)
+		}
+		if err != nil {
+			return LicensePolicy{}, err
+		}
+	}
+	return policy, nil
+}
+
+func toAudit(value interface{}) (Audit, error) {
+	var audit Audit
+
+	settings, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return audit, fmt.Errorf("nodejs.audit must be a map of settings")
+	}
+
+	for key, setting := range settings {
+		var err error
+		switch name := fmt.Sprint(key); name {
+		case "level":
+			if audit.Level, err = toString("audit.level", setting); err == nil {
+				switch audit.Level {
+				case "low", "moderate", "high", "critical", "none":
+				default:
+					err = fmt.Errorf("nodejs.audit.level must be low, moderate, high, critical or none")
+				}
+			}
+		case "ignore":
+			audit.Ignore, err = toStrings("audit.ignore", setting)
+		default:
+			err = fmt.Errorf("unknown key nodejs.audit.%s (valid keys: ignore, level)", name)
+		}
+		if err != nil {
+			return Audit{}, err
+		}
+	}
+	return audit, nil
+}
+
+func knownHook(name string) bool {
+	for _, hook := range Hooks {
+		if hook == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"nodejs/config"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var (
+		err      error
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	writeBuildpackYml := func(contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("Load", func() {
+		It("returns an empty config without buildpack.yml", func() {
+			Expect(config.Load(buildDir)).To(Equal(config.Config{}))
+		})
+
+		It("reads every setting under nodejs", func() {
+			writeBuildpackYml(`---
+nodejs:
+  version: 10.x
+  npm_version: 6
+  yarn_version: 1.x
+  pnpm_version: 3.x
+  start_command: node dist/server.js
+  build_scripts: [build, "build:assets"]
+  node_modules_cache: false
+  verbose: true
+  optimize_memory: true
+  run_build: false
+  prune_dev_dependencies: true
+  workspace: packages/api
+  hooks:
+    snyk: false
+  license_policy:
+    allow: [MIT, Apache-2.0]
+    deny: [GPL-3.0]
+    action: warn
+  audit:
+    level: critical
+    ignore: [GHSA-jf85-cpcp-j695]
+`)
+			c, err := config.Load(buildDir)
+			Expect(err).To(BeNil())
+
+			Expect(c.Version).To(Equal("10.x"))
+			Expect(c.NPMVersion).To(Equal("6"))
+			Expect(c.YarnVersion).To(Equal("1.x"))
+			Expect(c.PNPMVersion).To(Equal("3.x"))
+			Expect(c.StartCommand).To(Equal("node dist/server.js"))
+			Expect(c.BuildScripts).To(Equal([]string{"build", "build:assets"}))
+			Expect(*c.NodeModulesCache).To(BeFalse())
+			Expect(*c.Verbose).To(BeTrue())
+			Expect(*c.OptimizeMemory).To(BeTrue())
+			Expect(*c.RunBuild).To(BeFalse())
+			Expect(*c.PruneDevDeps).To(BeTrue())
+			Expect(c.Workspace).To(Equal("packages/api"))
+			Expect(c.Hooks).To(Equal(map[string]bool{"snyk": false}))
+			Expect(c.LicensePolicy).To(Equal(config.LicensePolicy{Allow: []string{"MIT", "Apache-2.0"}, Deny: []string{"GPL-3.0"}, Action: "warn"}))
+			Expect(c.Audit).To(Equal(config.Audit{Level: "critical", Ignore: []string{"GHSA-jf85-cpcp-j695"}}))
+		})
+
+		It("ignores sections for other buildpacks", func() {
+			writeBuildpackYml("python:\n  version: 3.6\n")
+			Expect(config.Load(buildDir)).To(Equal(config.Config{}))
+		})
+
+		It("rejects unknown keys", func() {
+			writeBuildpackYml("nodejs:\n  node_version: 10.x\n")
+			_, err := config.Load(buildDir)
+			Expect(err).To(MatchError(ContainSubstring("buildpack.yml: unknown key nodejs.node_version (valid keys: audit, build_scripts, hooks,")))
+		})
+
+		It("rejects unknown hooks", func() {
+			writeBuildpackYml("nodejs:\n  hooks:\n    newrelik: false\n")
+			_, err := config.Load(buildDir)
+			Expect(err).To(MatchError("buildpack.yml: unknown hook nodejs.hooks.newrelik (valid hooks: appdynamics, dynatrace, newrelic, seeker, snyk)"))
+		})
+
+		It("rejects values of the wrong type", func() {
+			writeBuildpackYml("nodejs:\n  node_modules_cache: sometimes\n")
+			_, err := config.Load(buildDir)
+			Expect(err).To(MatchError("buildpack.yml: nodejs.node_modules_cache must be true or false"))
+		})
+
+		It("rejects unquoted versions YAML reads as floats", func() {
+			writeBuildpackYml("nodejs:\n  version: 18.10\n")
+			_, err := config.Load(buildDir)
+			Expect(err).To(MatchError("buildpack.yml: nodejs.version must be quoted, YAML reads it as the number 18.1"))
+		})
+
+		It("rejects unknown license policy settings", func() {
+			writeBuildpackYml("nodejs:\n  license_policy:\n    action: block\n")
+			_, err := config.Load(buildDir)
+			Expect(err).To(MatchError("buildpack.yml: nodejs.license_policy.action must be warn or fail"))
+
+			writeBuildpackYml("nodejs:\n  license_policy:\n    allowed: [MIT]\n")
+			_, err = config.Load(buildDir)
+			Expect(err).To(MatchError("buildpack.yml: unknown key nodejs.license_policy.allowed (valid keys: action, allow, deny)"))
+		})
+
+		It("rejects unknown audit settings", func() {
+			writeBuildpackYml("nodejs:\n  audit:\n    level: severe\n")
+			_, err := config.Load(buildDir)
+			Expect(err).To(MatchError("buildpack.yml: nodejs.audit.level must be low, moderate, high, critical or none"))
+
+			writeBuildpackYml("nodejs:\n  audit:\n    ignores: [GHSA-jf85-cpcp-j695]\n")
+			_, err = config.Load(buildDir)
+			Expect(err).To(MatchError("buildpack.yml: unknown key nodejs.audit.ignores (valid keys: ignore, level)"))
+		})
+
+		It("reports YAML syntax errors", func() {
+			writeBuildpackYml("nodejs: [")
+			_, err := config.Load(buildDir)
+			Expect(err).To(MatchError(HavePrefix("buildpack.yml: ")))
+		})
+	})
+
+	Describe("HookEnabled", func() {
+		It("leaves hooks on by default", func() {
+			Expect(config.HookEnabled(buildDir, "snyk")).To(BeTrue())
+		})
+
+		It("honours hooks switched off in buildpack.yml", func() {
+			writeBuildpackYml("nodejs:\n  hooks:\n    snyk: false\n")
+			Expect(config.HookEnabled(buildDir, "snyk")).To(BeFalse())
+			Expect(config.HookEnabled(buildDir, "dynatrace")).To(BeTrue())
+		})
+	})
+})
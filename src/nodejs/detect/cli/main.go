@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"nodejs/detect"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print the detection result as JSON instead of the buildpack name")
+	flag.Parse()
+
+	logger := libbuildpack.NewLogger(os.Stderr)
+
+	if flag.NArg() < 1 {
+		logger.Error("Usage: detect [-json] <build-dir>")
+		os.Exit(2)
+	}
+
+	buildpackDir, err := libbuildpack.GetBuildpackDir()
+	if err != nil {
+		logger.Error("Unable to determine buildpack directory: %s", err.Error())
+		os.Exit(9)
+	}
+
+	manifest, err := libbuildpack.NewManifest(buildpackDir, logger, time.Now())
+	if err != nil {
+		logger.Error("Unable to load buildpack manifest: %s", err.Error())
+		os.Exit(10)
+	}
+
+	d := detect.Detector{
+		BuildDir: flag.Arg(0),
+		Log:      logger,
+	}
+
+	result, err := detect.Run(&d)
+	if err != nil {
+		os.Exit(12)
+	}
+
+	if *jsonOutput {
+		if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+			logger.Error("Unable to write detection result: %s", err.Error())
+			os.Exit(13)
+		}
+	} else if result.Detected {
+		version, err := manifest.Version()
+		if err != nil {
+			logger.Error("Unable to read buildpack version: %s", err.Error())
+			os.Exit(11)
+		}
+		fmt.Printf("%s %s\n", "node.js", version)
+	}
+
+	if !result.Detected {
+		os.Exit(1)
+	}
+}
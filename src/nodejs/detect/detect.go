@@ -0,0 +1,138 @@
+package detect
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type Detector struct {
+	BuildDir string
+	Log      *libbuildpack.Logger
+}
+
+type Result struct {
+	Detected             bool   `json:"detected"`
+	Reason               string `json:"reason"`
+	PackageManager       string `json:"package_manager,omitempty"`
+	PackageManagerReason string `json:"package_manager_reason,omitempty"`
+	Framework            string `json:"framework,omitempty"`
+	FrameworkReason      string `json:"framework_reason,omitempty"`
+}
+
+type packageJSON struct {
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+type framework struct {
+	name        string
+	packageName string
+	configFiles []string
+}
+
+// frameworks are checked in order, so meta-frameworks that depend on
+// express themselves must come before it.
+var frameworks = []framework{
+	{name: "next", packageName: "next", configFiles: []string{"next.config.js"}},
+	{name: "nuxt", packageName: "nuxt", configFiles: []string{"nuxt.config.js", "nuxt.config.ts"}},
+	{name: "nest", packageName: "@nestjs/core", configFiles: []string{"nest-cli.json"}},
+	{name: "express", packageName: "express"},
+}
+
+func Run(d *Detector) (Result, error) {
+	result, err := d.Detect()
+	if err != nil {
+		d.Log.Error("Unable to detect app: %s", err.Error())
+		return result, err
+	}
+
+	if !result.Detected {
+		d.Log.Info("Not a Node.js app: %s", result.Reason)
+		return result, nil
+	}
+
+	d.Log.Info("Detected Node.js app: %s", result.Reason)
+	d.Log.Info("Package manager: %s (%s)", result.PackageManager, result.PackageManagerReason)
+	if result.Framework != "" {
+		d.Log.Info("Framework: %s (%s)", result.Framework, result.FrameworkReason)
+	} else {
+		d.Log.Info("Framework: none detected")
+	}
+
+	return result, nil
+}
+
+func (d *Detector) Detect() (Result, error) {
+	var result Result
+	var p packageJSON
+
+	if err := libbuildpack.NewJSON().Load(filepath.Join(d.BuildDir, "package.json"), &p); err != nil {
+		if os.IsNotExist(err) {
+			result.Reason = "no package.json found in the app root"
+			return result, nil
+		} else if _, ok := err.(*os.PathError); ok {
+			return result, err
+		}
+
+		result.Detected = true
+		result.Reason = "package.json found, but it could not be parsed"
+	} else {
+		result.Detected = true
+		result.Reason = "package.json found"
+	}
+
+	var err error
+	if result.PackageManager, result.PackageManagerReason, err = d.packageManager(); err != nil {
+		return result, err
+	}
+
+	if result.Framework, result.FrameworkReason, err = d.framework(p); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (d *Detector) packageManager() (string, string, error) {
+	lockfiles := []struct {
+		name    string
+		manager string
+	}{
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+		{"package-lock.json", "npm"},
+		{"npm-shrinkwrap.json", "npm"},
+	}
+
+	for _, lockfile := range lockfiles {
+		if found, err := libbuildpack.FileExists(filepath.Join(d.BuildDir, lockfile.name)); err != nil {
+			return "", "", err
+		} else if found {
+			return lockfile.manager, lockfile.name + " found", nil
+		}
+	}
+
+	return "npm", "no lockfile found, defaulting to npm", nil
+}
+
+func (d *Detector) framework(p packageJSON) (string, string, error) {
+	for _, fw := range frameworks {
+		if _, found := p.Dependencies[fw.packageName]; found {
+			return fw.name, fw.packageName + " listed in dependencies", nil
+		}
+		if _, found := p.DevDependencies[fw.packageName]; found {
+			return fw.name, fw.packageName + " listed in devDependencies", nil
+		}
+		for _, configFile := range fw.configFiles {
+			if found, err := libbuildpack.FileExists(filepath.Join(d.BuildDir, configFile)); err != nil {
+				return "", "", err
+			} else if found {
+				return fw.name, configFile + " found", nil
+			}
+		}
+	}
+
+	return "", "", nil
+}
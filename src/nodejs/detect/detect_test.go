@@ -0,0 +1,191 @@
+package detect_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"nodejs/detect"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Detect", func() {
+	var (
+		err      error
+		buildDir string
+		detector *detect.Detector
+		logger   *libbuildpack.Logger
+		buffer   *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+
+		detector = &detect.Detector{
+			BuildDir: buildDir,
+			Log:      logger,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	writeFile := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("Detect", func() {
+		Context("package.json does not exist", func() {
+			It("does not detect the app and explains why", func() {
+				result, err := detector.Detect()
+				Expect(err).To(BeNil())
+				Expect(result.Detected).To(BeFalse())
+				Expect(result.Reason).To(Equal("no package.json found in the app root"))
+			})
+		})
+
+		Context("package.json is invalid JSON", func() {
+			BeforeEach(func() {
+				writeFile("package.json", "not actually JSON")
+			})
+
+			It("still detects the app", func() {
+				result, err := detector.Detect()
+				Expect(err).To(BeNil())
+				Expect(result.Detected).To(BeTrue())
+				Expect(result.Reason).To(Equal("package.json found, but it could not be parsed"))
+			})
+		})
+
+		Context("package.json exists", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{"dependencies": {"express": "~4.0.0"}}`)
+			})
+
+			It("detects the app", func() {
+				result, err := detector.Detect()
+				Expect(err).To(BeNil())
+				Expect(result.Detected).To(BeTrue())
+				Expect(result.Reason).To(Equal("package.json found"))
+			})
+
+			It("defaults to npm when there is no lockfile", func() {
+				result, err := detector.Detect()
+				Expect(err).To(BeNil())
+				Expect(result.PackageManager).To(Equal("npm"))
+				Expect(result.PackageManagerReason).To(Equal("no lockfile found, defaulting to npm"))
+			})
+
+			Context("yarn.lock exists", func() {
+				BeforeEach(func() {
+					writeFile("yarn.lock", "")
+					writeFile("package-lock.json", "{}")
+				})
+
+				It("selects yarn", func() {
+					result, err := detector.Detect()
+					Expect(err).To(BeNil())
+					Expect(result.PackageManager).To(Equal("yarn"))
+					Expect(result.PackageManagerReason).To(Equal("yarn.lock found"))
+				})
+			})
+
+			Context("pnpm-lock.yaml exists", func() {
+				BeforeEach(func() {
+					writeFile("pnpm-lock.yaml", "")
+					writeFile("yarn.lock", "")
+				})
+
+				It("selects pnpm", func() {
+					result, err := detector.Detect()
+					Expect(err).To(BeNil())
+					Expect(result.PackageManager).To(Equal("pnpm"))
+					Expect(result.PackageManagerReason).To(Equal("pnpm-lock.yaml found"))
+				})
+			})
+
+			Context("npm-shrinkwrap.json exists", func() {
+				BeforeEach(func() {
+					writeFile("npm-shrinkwrap.json", "{}")
+				})
+
+				It("selects npm", func() {
+					result, err := detector.Detect()
+					Expect(err).To(BeNil())
+					Expect(result.PackageManager).To(Equal("npm"))
+					Expect(result.PackageManagerReason).To(Equal("npm-shrinkwrap.json found"))
+				})
+			})
+
+			It("detects express from dependencies", func() {
+				result, err := detector.Detect()
+				Expect(err).To(BeNil())
+				Expect(result.Framework).To(Equal("express"))
+				Expect(result.FrameworkReason).To(Equal("express listed in dependencies"))
+			})
+		})
+
+		Context("package.json lists several frameworks", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{"dependencies": {"express": "4.x"}, "devDependencies": {"@nestjs/core": "5.x"}}`)
+			})
+
+			It("prefers the more specific framework", func() {
+				result, err := detector.Detect()
+				Expect(err).To(BeNil())
+				Expect(result.Framework).To(Equal("nest"))
+				Expect(result.FrameworkReason).To(Equal("@nestjs/core listed in devDependencies"))
+			})
+		})
+
+		Context("a framework config file exists", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{}`)
+				writeFile("nuxt.config.js", "module.exports = {}")
+			})
+
+			It("detects the framework from the config file", func() {
+				result, err := detector.Detect()
+				Expect(err).To(BeNil())
+				Expect(result.Framework).To(Equal("nuxt"))
+				Expect(result.FrameworkReason).To(Equal("nuxt.config.js found"))
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		Context("the app is detected", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{"dependencies": {"next": "6.x"}}`)
+				writeFile("yarn.lock", "")
+			})
+
+			It("logs why the app was detected", func() {
+				result, err := detect.Run(detector)
+				Expect(err).To(BeNil())
+				Expect(result.Detected).To(BeTrue())
+				Expect(buffer.String()).To(ContainSubstring("Detected Node.js app: package.json found"))
+				Expect(buffer.String()).To(ContainSubstring("Package manager: yarn (yarn.lock found)"))
+				Expect(buffer.String()).To(ContainSubstring("Framework: next (next listed in dependencies)"))
+			})
+		})
+
+		Context("the app is not detected", func() {
+			It("logs why the app was not detected", func() {
+				result, err := detect.Run(detector)
+				Expect(err).To(BeNil())
+				Expect(result.Detected).To(BeFalse())
+				Expect(buffer.String()).To(ContainSubstring("Not a Node.js app: no package.json found in the app root"))
+			})
+		})
+	})
+})
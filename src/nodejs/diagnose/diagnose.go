@@ -0,0 +1,154 @@
+package diagnose
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Filename is the name of a rules file in the buildpack or a deps dir.
+const Filename = "diagnostics.yml"
+
+// Rule explains a failure recognised by Pattern, a regular expression
+// matched against each line of the staging log. Message may refer to the
+// pattern's groups as $1, $2 and so on, and to staging facts as {name}.
+// Rules marked Always point out problems that do not fail staging, so they
+// are reported after a successful install too. A rule with When only applies
+// when the staging fact it names is "true".
+type Rule struct {
+	ID      string `yaml:"id"`
+	Pattern string `yaml:"pattern"`
+	Message string `yaml:"message"`
+	Link    string `yaml:"link"`
+	Always  bool   `yaml:"always"`
+	When    string `yaml:"when"`
+
+	re *regexp.Regexp
+}
+
+// Finding is a rule that matched, with its message filled in.
+type Finding struct {
+	Rule    Rule
+	Line    string
+	Message string
+}
+
+// Facts describe the staging run, such as the package_manager, for rule
+// messages and conditions.
+type Facts map[string]string
+
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load returns the default rules, followed by those in Filename in
+// buildpackDir and in any deps dir. A rule replaces the earlier one with the
+// same id, so operators can reword or, with an empty pattern, switch off a
+// default.
+func Load(buildpackDir, depsDir string) ([]Rule, error) {
+	var rules []Rule
+	byID := map[string]int{}
+
+	add := func(source string, rule Rule) error {
+		if rule.ID == "" {
+			return fmt.Errorf("%s: rule %q needs an id", source, rule.Pattern)
+		}
+		if rule.Pattern != "" {
+			var err error
+			if rule.re, err = regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("%s: rule %s has an invalid pattern: %s", source, rule.ID, err)
+			}
+		}
+		if idx, found := byID[rule.ID]; found {
+			rules[idx] = rule
+		} else {
+			byID[rule.ID] = len(rules)
+			rules = append(rules, rule)
+		}
+		return nil
+	}
+
+	for _, rule := range Defaults {
+		if err := add("default rules", rule); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := []string{filepath.Join(buildpackDir, Filename)}
+	if dirs, err := ioutil.ReadDir(depsDir); err == nil {
+		for _, dir := range dirs {
+			if dir.IsDir() {
+				paths = append(paths, filepath.Join(depsDir, dir.Name(), Filename))
+			}
+		}
+	}
+	for _, path := range paths {
+		var file rulesFile
+		if err := libbuildpack.NewYAML().Load(path, &file); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		for _, rule := range file.Rules {
+			if err := add(path, rule); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// Analyze reports each rule that matches a line of the log at path, once,
+// in the order the rules are listed. Rules whose When fact is not "true" are
+// skipped.
+func Analyze(path string, rules []Rule, facts Facts) ([]Finding, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	matched := make([]*Finding, len(rules))
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for i, rule := range rules {
+			if matched[i] != nil || rule.re == nil || (rule.When != "" && facts[rule.When] != "true") {
+				continue
+			}
+			if groups := rule.re.FindStringSubmatchIndex(line); groups != nil {
+				message := string(rule.re.ExpandString(nil, facts.fill(rule.Message), line, groups))
+				matched[i] = &Finding{Rule: rule, Line: line, Message: message}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, finding := range matched {
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	return findings, nil
+}
+
+// fill replaces each {name} in message with the fact's value, escaped so
+// that it is not read as a group reference.
+func (f Facts) fill(message string) string {
+	for name, value := range f {
+		message = strings.Replace(message, "{"+name+"}", strings.Replace(value, "$", "$$", -1), -1)
+	}
+	return message
+}
@@ -0,0 +1,194 @@
+package diagnose_test
+
+import (
+	"io/ioutil"
+	"nodejs/diagnose"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diagnose", func() {
+	var (
+		err          error
+		buildpackDir string
+		depsDir      string
+		logfile      string
+	)
+
+	BeforeEach(func() {
+		buildpackDir, err = ioutil.TempDir("", "nodejs-buildpack.buildpack.")
+		Expect(err).To(BeNil())
+		depsDir, err = ioutil.TempDir("", "nodejs-buildpack.deps.")
+		Expect(err).To(BeNil())
+		logfile = filepath.Join(depsDir, "staging.log")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildpackDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	analyzeWith := func(log string, facts diagnose.Facts) []diagnose.Finding {
+		Expect(ioutil.WriteFile(logfile, []byte(log), 0644)).To(Succeed())
+		rules, err := diagnose.Load(buildpackDir, depsDir)
+		Expect(err).To(BeNil())
+		findings, err := diagnose.Analyze(logfile, rules, facts)
+		Expect(err).To(BeNil())
+		return findings
+	}
+
+	analyze := func(log string) []diagnose.Finding {
+		return analyzeWith(log, diagnose.Facts{"package_manager": "npm"})
+	}
+
+	DescribeTable("recognising failures",
+		func(line, id, message string) {
+			findings := analyze("       Installing node modules\n" + line + "\n")
+			Expect(findings).To(HaveLen(1))
+			Expect(findings[0].Rule.ID).To(Equal(id))
+			Expect(findings[0].Line).To(Equal(line))
+			Expect(findings[0].Message).To(ContainSubstring(message))
+		},
+		Entry("EACCES", "npm ERR! Error: EACCES: permission denied, mkdir '/tmp/app/node_modules/.staging'", "eacces", "Permission denied on /tmp/app/node_modules/.staging."),
+		Entry("ENOSPC", "npm ERR! nospc ENOSPC: no space left on device, write", "enospc", "ran out of disk space"),
+		Entry("ETIMEDOUT", "npm ERR! network request to https://registry.npmjs.org/express failed, reason: connect ETIMEDOUT 104.16.20.35:443", "network", "failed with ETIMEDOUT"),
+		Entry("ECONNRESET", "error An unexpected error occurred: \"https://registry.yarnpkg.com/react: read ECONNRESET\".", "network", "failed with ECONNRESET"),
+		Entry("E404 on a scoped package", "npm ERR! 404 Not Found - GET https://registry.npmjs.org/@corp%2fwidgets - Not found", "scoped-404", "no package @corp%2fwidgets"),
+		Entry("yarn 404 on a scoped package", "error An unexpected error occurred: \"https://registry.yarnpkg.com/@corp/widgets: Request failed \\\"404 Not Found\\\"\".", "scoped-404", "no package @corp/widgets"),
+		Entry("gyp without Xcode", "gyp: No Xcode or CLT version detected!", "gyp-xcode", "built on a Mac"),
+		Entry("gyp without python", "gyp ERR! stack Error: Can't find Python executable \"python\", you can set the PYTHON env variable.", "gyp-python", "needs Python"),
+		Entry("integrity mismatch", "npm ERR! code EINTEGRITY", "integrity", "does not match the integrity hash"),
+		Entry("failing script", "npm ERR! my-app@1.0.0 build: `webpack --mode production`", "elifecycle", "A package.json script failed (build)"),
+		Entry("unmet dependency", "npm WARN ajv-keywords@3.4.1 requires a peer of ajv@^6.9.1 but none is installed. UNMET PEER DEPENDENCY", "unmet-dependency", "Unmet dependencies don't fail npm install"),
+		Entry("gulp not found", "sh: 1: gulp: not found", "gulp-not-found", "Gulp may not be tracked"),
+		Entry("missing module", "Error: Cannot find module 'express'", "missing-module", "A module may be missing from 'dependencies'"),
+	)
+
+	DescribeTable("explaining a failing package.json script",
+		func(log, message string) {
+			var scripts []diagnose.Finding
+			for _, finding := range analyze(log) {
+				if finding.Rule.ID == "elifecycle" {
+					scripts = append(scripts, finding)
+				}
+			}
+			Expect(scripts).To(HaveLen(1))
+			Expect(scripts[0].Message).To(HavePrefix(message))
+		},
+		Entry("npm 6", `
+> my-app@1.0.0 build /tmp/app
+> webpack --mode production
+
+sh: 1: webpack: not found
+npm ERR! code ELIFECYCLE
+npm ERR! syscall spawn
+npm ERR! file sh
+npm ERR! errno ENOENT
+npm ERR! my-app@1.0.0 build: `+"`webpack --mode production`"+`
+npm ERR! spawn ENOENT
+npm ERR!
+npm ERR! Failed at the my-app@1.0.0 build script.
+npm ERR! This is probably not a problem with npm. There is likely additional logging output above.
+`, "A package.json script failed (build);"),
+		Entry("npm 8", `
+> my-app@1.0.0 build
+> webpack --mode production
+
+sh: 1: webpack: not found
+npm ERR! code 127
+npm ERR! path /tmp/app
+npm ERR! command failed
+npm ERR! command sh -c webpack --mode production
+
+npm ERR! A complete log of this run can be found in:
+npm ERR!     /home/vcap/.npm/_logs/2023-01-01T00_00_00_000Z-debug-0.log
+`, "A package.json script failed (webpack --mode production);"),
+		Entry("npm 10", `
+> my-app@1.0.0 build
+> webpack --mode production
+
+sh: 1: webpack: not found
+npm error code 127
+npm error path /tmp/app
+npm error command failed
+npm error command sh -c webpack --mode production
+`, "A package.json script failed (webpack --mode production);"),
+		Entry("npm 8 in a workspace", `
+npm ERR! Lifecycle script `+"`build`"+` failed with error:
+npm ERR! Error: command failed
+npm ERR!   in workspace: web@1.0.0
+npm ERR!   at location: /tmp/app/packages/web
+`, "A package.json script failed (build);"),
+	)
+
+	It("reports each rule once, in rule order", func() {
+		findings := analyze("npm ERR! code EINTEGRITY\nread ECONNRESET\nconnect ETIMEDOUT\n")
+		Expect(findings).To(HaveLen(2))
+		Expect(findings[0].Rule.ID).To(Equal("network"))
+		Expect(findings[0].Message).To(ContainSubstring("ECONNRESET"))
+		Expect(findings[1].Rule.ID).To(Equal("integrity"))
+	})
+
+	It("fills in staging facts", func() {
+		findings := analyzeWith("warning \" > ajv-keywords@3.4.1\" has unmet peer dependency \"ajv@^6.9.1\".\n", diagnose.Facts{"package_manager": "yarn"})
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Message).To(HavePrefix("Unmet dependencies don't fail yarn install"))
+	})
+
+	It("applies a rule with when only if its fact is true", func() {
+		log := "Error: Cannot find module 'webpack'\n"
+		Expect(analyzeWith(log, diagnose.Facts{"dev_dependencies_omitted": "false"})).To(HaveLen(1))
+
+		findings := analyzeWith(log, diagnose.Facts{"dev_dependencies_omitted": "true"})
+		Expect(findings).To(HaveLen(2))
+		Expect(findings[0].Rule.ID).To(Equal("missing-module"))
+		Expect(findings[1].Rule.ID).To(Equal("missing-dev-dependency"))
+		Expect(findings[1].Message).To(ContainSubstring("'devDependencies' instead of 'dependencies'"))
+	})
+
+	It("finds nothing in a clean log", func() {
+		Expect(analyze("       Installing node modules\n       added 50 packages in 2s\n")).To(BeEmpty())
+	})
+
+	Context("operators add rules", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildpackDir, diagnose.Filename), []byte(`---
+rules:
+- id: proxy-auth
+  pattern: 407 Proxy Authentication Required
+  message: The corporate proxy rejected staging. Ask the platform team for proxy credentials.
+  link: https://wiki.example.com/proxy
+- id: enospc
+  pattern: ENOSPC
+  message: Out of disk, ask for a bigger quota.
+`), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(depsDir, "0"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(depsDir, "0", diagnose.Filename), []byte("rules:\n- id: network\n  pattern: ''\n"), 0644)).To(Succeed())
+		})
+
+		It("matches them alongside the defaults", func() {
+			findings := analyze("npm ERR! 407 Proxy Authentication Required\nnpm ERR! code EINTEGRITY\n")
+			Expect(findings).To(HaveLen(2))
+			Expect(findings[0].Rule.ID).To(Equal("integrity"))
+			Expect(findings[1].Rule.ID).To(Equal("proxy-auth"))
+			Expect(findings[1].Rule.Link).To(Equal("https://wiki.example.com/proxy"))
+		})
+
+		It("lets them replace or switch off a default", func() {
+			findings := analyze("npm ERR! nospc ENOSPC\nconnect ETIMEDOUT\n")
+			Expect(findings).To(HaveLen(1))
+			Expect(findings[0].Message).To(Equal("Out of disk, ask for a bigger quota."))
+		})
+	})
+
+	It("rejects an invalid pattern", func() {
+		Expect(ioutil.WriteFile(filepath.Join(buildpackDir, diagnose.Filename), []byte("rules:\n- id: broken\n  pattern: '(unclosed'\n"), 0644)).To(Succeed())
+		_, err := diagnose.Load(buildpackDir, depsDir)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("rule broken has an invalid pattern"))
+	})
+})
@@ -0,0 +1,95 @@
+package diagnose
+
+// Defaults recognise common npm, yarn and node-gyp failures, and a few
+// problems that install fine but break the app later.
+var Defaults = []Rule{
+	{
+		ID:      "eacces",
+		Pattern: `EACCES[^']*'([^']+)'`,
+		Message: "Permission denied on $1. Check that files pushed with the app are writable, and that scripts do not write outside the app directory or node_modules.",
+		Link:    "https://docs.npmjs.com/resolving-eacces-permissions-errors-when-installing-packages-globally",
+	},
+	{
+		ID:      "enospc",
+		Pattern: `ENOSPC|[Nn]o space left on device`,
+		Message: "Staging ran out of disk space. Raise the app's disk quota with cf push -k, or keep large files out of the app with .cfignore.",
+		Link:    "https://docs.cloudfoundry.org/devguide/deploy-apps/large-app-deploy.html",
+	},
+	{
+		ID:      "network",
+		Pattern: `(ETIMEDOUT|ECONNRESET|ECONNREFUSED|ENOTFOUND|EAI_AGAIN)`,
+		Message: "A download failed with $1. The registry may be unreachable from the staging container; check the proxy settings and that the registry allows connections from Cloud Foundry.",
+		Link:    "https://docs.cloudfoundry.org/buildpacks/proxy-usage.html",
+	},
+	{
+		ID:      "scoped-404",
+		Pattern: `404.*?(@[a-z0-9][\w.-]*(?:/|%2[fF])[a-z0-9][\w.-]*)|(@[a-z0-9][\w.-]*(?:/|%2[fF])[a-z0-9][\w.-]*).*404`,
+		Message: "The registry has no package ${1}${2}. Scoped packages usually come from a private registry: bind an npm-registry service or set NPM_REGISTRY_<SCOPE> and NPM_TOKEN_<SCOPE>.",
+		Link:    "https://docs.npmjs.com/cli/using-npm/scope",
+	},
+	{
+		ID:      "gyp-xcode",
+		Pattern: `No Xcode or CLT version detected`,
+		Message: "node-gyp looked for the macOS build tools, so node_modules built on a Mac was probably pushed. Add node_modules to .cfignore so native modules are built on the stack.",
+		Link:    "https://github.com/nodejs/node-gyp#installation",
+	},
+	{
+		ID:      "gyp-python",
+		Pattern: `gyp ERR!.*([Cc]an't find Python|[Cc]ould not find any Python|python: not found)`,
+		Message: "node-gyp needs Python to build a native module, and the stack has none it can use. Use a version of the module with prebuilt binaries, or vendor node_modules built on the same stack.",
+		Link:    "https://github.com/nodejs/node-gyp#on-unix",
+	},
+	{
+		ID:      "integrity",
+		Pattern: `EINTEGRITY|[Ii]ntegrity check failed|integrity checksum failed`,
+		Message: "A downloaded package does not match the integrity hash in the lockfile. Regenerate the lockfile against the registry staging uses, or set NODE_MODULES_CACHE=false to rule out a stale cache.",
+		Link:    "https://docs.npmjs.com/cli/configuring-npm/package-lock-json",
+	},
+	{
+		// npm 6 names the package and script, npm 7 and later only the
+		// command, or the script when it ran in a workspace.
+		ID:      "elifecycle",
+		Pattern: "npm ERR! \\S+@\\S+ ([\\w:.-]+): |npm (?:ERR!|error) command sh -c (.+)|npm (?:ERR!|error) Lifecycle script `([\\w:.-]+)` failed",
+		Message: "A package.json script failed (${1}${2}${3}); its output above shows why. Scripts run with NODE_ENV=production and, unless prune_dev_dependencies is set, without devDependencies.",
+		Link:    "https://docs.npmjs.com/cli/using-npm/scripts",
+	},
+	{
+		ID:      "unmet-dependency",
+		Pattern: `(?i)unmet (peer )?dependency`,
+		Message: "Unmet dependencies don't fail {package_manager} install but may cause runtime issues.",
+		Link:    "https://github.com/npm/npm/issues/7494",
+		Always:  true,
+	},
+	{
+		ID:      "grunt-not-found",
+		Pattern: `(?i)grunt: (command )?not found`,
+		Message: "Grunt may not be tracked in package.json.",
+		Always:  true,
+	},
+	{
+		ID:      "bower-not-found",
+		Pattern: `(?i)bower: (command )?not found`,
+		Message: "Bower may not be tracked in package.json.",
+		Always:  true,
+	},
+	{
+		ID:      "gulp-not-found",
+		Pattern: `(?i)gulp: (command )?not found`,
+		Message: "Gulp may not be tracked in package.json.",
+		Always:  true,
+	},
+	{
+		ID:      "missing-module",
+		Pattern: `(?i)cannot find module`,
+		Message: "A module may be missing from 'dependencies' in package.json.",
+		Always:  true,
+	},
+	{
+		ID:      "missing-dev-dependency",
+		Pattern: `(?i)cannot find module`,
+		Message: "This module may be specified in 'devDependencies' instead of 'dependencies', which are not installed with NPM_CONFIG_PRODUCTION=true.",
+		Link:    "https://devcenter.heroku.com/articles/nodejs-support#devdependencies",
+		Always:  true,
+		When:    "dev_dependencies_omitted",
+	},
+}
@@ -3,9 +3,14 @@ package main
 import (
 	"io"
 	"io/ioutil"
+	"nodejs/arch"
+	"nodejs/certs"
 	"nodejs/finalize"
-	_ "nodejs/hooks"
+	"nodejs/hooks"
+	"nodejs/launch"
+	"nodejs/report"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
@@ -20,8 +25,10 @@ func main() {
 		os.Exit(8)
 	}
 
+	rep := report.New()
 	stdout := io.MultiWriter(os.Stdout, logfile)
-	logger := libbuildpack.NewLogger(stdout)
+	logger := libbuildpack.NewLogger(rep.Writer(stdout))
+	hooks.SetOutput(rep.Writer(stdout))
 
 	buildpackDir, err := libbuildpack.GetBuildpackDir()
 	if err != nil {
@@ -41,6 +48,17 @@ func main() {
 		logger.Error("Unable to apply override.yml files: %s", err)
 		os.Exit(17)
 	}
+	if dropped, err := arch.Filter(manifest, stager.DepsDir(), arch.Current()); err != nil {
+		logger.Error("Unable to select dependencies: %s", err)
+		os.Exit(18)
+	} else if dropped > 0 {
+		logger.Debug("Ignoring %d dependencies built for other architectures than %s", dropped, arch.Current())
+	}
+
+	if _, err := certs.Configure(stager.DepsDir(), stager.DepDir()); err != nil {
+		logger.Error("Unable to configure CA certificates: %s", err.Error())
+		os.Exit(16)
+	}
 
 	if err := stager.SetStagingEnvironment(); err != nil {
 		logger.Error("Unable to setup environment variables: %s", err.Error())
@@ -54,15 +72,43 @@ func main() {
 		Logfile:  logfile,
 	}
 
-	if err := finalize.Run(&f); err != nil {
+	// bin/finalize builds the launch helper next to this binary.
+	if executable, err := os.Executable(); err == nil {
+		f.LaunchHelper = filepath.Join(filepath.Dir(executable), launch.Helper)
+	}
+
+	// Hooks and the SBOM write add warnings and steps after finalize.Run, so
+	// the report is saved again after each.
+	saveReport := func() {
+		if err := rep.Save(stager.DepDir()); err != nil {
+			logger.Error("Unable to write %s: %s", report.Filename, err.Error())
+		}
+	}
+
+	err = finalize.Run(&f)
+	saveReport()
+	if err != nil {
 		os.Exit(12)
 	}
 
-	if err := libbuildpack.RunAfterCompile(stager); err != nil {
+	err = libbuildpack.RunAfterCompile(stager)
+	if err != nil {
 		logger.Error("After Compile: %s", err.Error())
+	}
+	saveReport()
+	if err != nil {
 		os.Exit(13)
 	}
 
+	err = f.WriteSBOM()
+	if err != nil {
+		logger.Error("Unable to write SBOM: %s", err.Error())
+	}
+	saveReport()
+	if err != nil {
+		os.Exit(15)
+	}
+
 	if err := stager.SetLaunchEnvironment(); err != nil {
 		logger.Error("Unable to setup launch environment: %s", err.Error())
 		os.Exit(14)
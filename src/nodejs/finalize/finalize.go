@@ -2,21 +2,26 @@ package finalize
 
 import (
 	"io/ioutil"
+	"nodejs/config"
+	"nodejs/inventory"
+	"nodejs/launch"
+	"nodejs/report"
+	"nodejs/sbom"
+	"nodejs/workspace"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
 
 type Manifest interface {
 	RootDir() string
+	Version() (string, error)
 }
 
 type Stager interface {
 	BuildDir() string
 	DepDir() string
-	DepsIdx() string
 }
 
 type Finalizer struct {
@@ -24,10 +29,28 @@ type Finalizer struct {
 	Log         *libbuildpack.Logger
 	Logfile     *os.File
 	Manifest    Manifest
+	Config      config.Config
 	StartScript string
+	Main        string
+	Workspace   string
+	// LaunchHelper is the launch-env binary built with this finalize.
+	LaunchHelper string
 }
 
 func Run(f *Finalizer) error {
+	var err error
+	if f.Config, err = config.Load(f.Stager.BuildDir()); err != nil {
+		f.Log.Error("Unable to load buildpack.yml: %s", err.Error())
+		return err
+	}
+
+	ws, err := workspace.Selected(f.Stager.BuildDir(), f.Config.Workspace)
+	if err != nil {
+		f.Log.Error("Unable to select workspace: %s", err.Error())
+		return err
+	}
+	f.Workspace = ws.Dir
+
 	if err := f.ReadPackageJSON(); err != nil {
 		f.Log.Error("Failed parsing package.json: %s", err.Error())
 		return err
@@ -38,6 +61,11 @@ func Run(f *Finalizer) error {
 		return err
 	}
 
+	if err := f.InstallLaunchHelper(); err != nil {
+		f.Log.Error("Unable to install launch helper: %s", err.Error())
+		return err
+	}
+
 	if err := f.WarnNoStart(); err != nil {
 		f.Log.Error(err.Error())
 		return err
@@ -56,9 +84,10 @@ func (f *Finalizer) ReadPackageJSON() error {
 		Scripts struct {
 			StartScript string `json:"start"`
 		} `json:"scripts"`
+		Main string `json:"main"`
 	}
 
-	if err := libbuildpack.NewJSON().Load(filepath.Join(f.Stager.BuildDir(), "package.json"), &p); err != nil {
+	if err := libbuildpack.NewJSON().Load(filepath.Join(f.Stager.BuildDir(), f.Workspace, "package.json"), &p); err != nil {
 		if os.IsNotExist(err) {
 			f.Log.Warning("No package.json found")
 			return nil
@@ -68,55 +97,60 @@ func (f *Finalizer) ReadPackageJSON() error {
 	}
 
 	f.StartScript = p.Scripts.StartScript
+	f.Main = p.Main
 
 	return nil
 }
 
+// CopyProfileScripts copies any scripts in the buildpack's profile directory
+// into profile.d. The launch helper does the buildpack's own setup.
 func (f *Finalizer) CopyProfileScripts() error {
-	profiledDir := filepath.Join(f.Stager.DepDir(), "profile.d")
-	if err := os.MkdirAll(profiledDir, 0755); err != nil {
-		return err
-	}
-
-	scriptsDir := filepath.Join(f.Stager.DepDir(), "scripts")
-	if err := os.MkdirAll(scriptsDir, 0755); err != nil {
-		return err
-	}
-
 	path := filepath.Join(f.Manifest.RootDir(), "profile")
 	files, err := ioutil.ReadDir(path)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	profiledDir := filepath.Join(f.Stager.DepDir(), "profile.d")
+	if err := os.MkdirAll(profiledDir, 0755); err != nil {
 		return err
 	}
 
 	for _, fi := range files {
-		if strings.HasSuffix(fi.Name(), ".rb") {
-			if err := libbuildpack.CopyFile(filepath.Join(path, fi.Name()), filepath.Join(scriptsDir, fi.Name())); err != nil {
-				return err
-			}
-			if err := ioutil.WriteFile(filepath.Join(profiledDir, fi.Name()+".sh"), []byte("eval $(ruby $DEPS_DIR/"+f.Stager.DepsIdx()+"/scripts/"+fi.Name()+")\n"), 0755); err != nil {
-				return err
-			}
-		} else {
-			if err := libbuildpack.CopyFile(filepath.Join(path, fi.Name()), filepath.Join(profiledDir, fi.Name())); err != nil {
-				return err
-			}
+		if err := libbuildpack.CopyFile(filepath.Join(path, fi.Name()), filepath.Join(profiledDir, fi.Name())); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// InstallLaunchHelper copies the helper that sizes memory and concurrency at
+// launch into the dep dir, where profile.d/node.sh runs it.
+func (f *Finalizer) InstallLaunchHelper() error {
+	if f.LaunchHelper == "" {
+		return nil
+	}
+	dest := filepath.Join(f.Stager.DepDir(), launch.Helper)
+	if err := libbuildpack.CopyFile(f.LaunchHelper, dest); err != nil {
+		return err
+	}
+	return os.Chmod(dest, 0755)
+}
+
 func (f *Finalizer) WarnNoStart() error {
 	procfileExists, err := libbuildpack.FileExists(filepath.Join(f.Stager.BuildDir(), "Procfile"))
 	if err != nil {
 		return err
 	}
-	serverJsExists, err := libbuildpack.FileExists(filepath.Join(f.Stager.BuildDir(), "server.js"))
+	serverJsExists, err := libbuildpack.FileExists(filepath.Join(f.Stager.BuildDir(), f.Workspace, "server.js"))
 	if err != nil {
 		return err
 	}
 
-	if !procfileExists && !serverJsExists && f.StartScript == "" {
+	if !procfileExists && !serverJsExists && f.StartScript == "" && f.Config.StartCommand == "" {
 		warning := "This app may not specify any way to start a node process\n"
 		warning += "See: https://docs.cloudfoundry.org/buildpacks/node/node-tips.html#start"
 		f.Log.Warning(warning)
@@ -124,3 +158,45 @@ func (f *Finalizer) WarnNoStart() error {
 
 	return nil
 }
+
+// WriteSBOM records the node runtime, the package managers and every
+// installed package as a CycloneDX SBOM in the dep dir. It runs after the
+// hooks so modules they add are included.
+func (f *Finalizer) WriteSBOM() error {
+	buildpackVersion, err := f.Manifest.Version()
+	if err != nil {
+		return err
+	}
+
+	var app struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := libbuildpack.NewJSON().Load(filepath.Join(f.Stager.BuildDir(), f.Workspace, "package.json"), &app); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	bom, err := sbom.New(app.Name, app.Version, buildpackVersion)
+	if err != nil {
+		return err
+	}
+
+	staged, err := report.Load(f.Stager.DepDir())
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"node", "npm", "yarn", "pnpm"} {
+		if tool, found := staged.Tools[name]; found && tool.Version != "" {
+			bom.AddTool(name, tool.Version)
+		}
+	}
+
+	packages, err := inventory.Inventory(f.Stager.BuildDir(), inventory.NodeModulesDirs(f.Stager.BuildDir(), f.Stager.DepDir(), f.Workspace)...)
+	if err != nil {
+		return err
+	}
+	bom.AddPackages(packages)
+
+	f.Log.Info("Writing %s (%d packages)", sbom.Filename, len(packages))
+	return bom.Write(filepath.Join(f.Stager.DepDir(), sbom.Filename))
+}
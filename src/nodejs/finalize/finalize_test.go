@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"nodejs/finalize"
+	"nodejs/sbom"
 	"os"
 	"path/filepath"
 
@@ -86,6 +87,31 @@ var _ = Describe("Finalize", func() {
 				Expect(finalizer.StartScript).To(Equal("start-my-app"))
 			})
 		})
+
+		Context("package.json has main", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"main": "lib/app.js"}`), 0644)).To(Succeed())
+			})
+
+			It("sets Main", func() {
+				Expect(finalizer.ReadPackageJSON()).To(Succeed())
+				Expect(finalizer.Main).To(Equal("lib/app.js"))
+			})
+		})
+
+		Context("a workspace is selected", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"scripts": {"start": "root-start"}}`), 0644)).To(Succeed())
+				Expect(os.MkdirAll(filepath.Join(buildDir, "packages", "api"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "packages", "api", "package.json"), []byte(`{"scripts": {"start": "api-start"}}`), 0644)).To(Succeed())
+				finalizer.Workspace = filepath.Join("packages", "api")
+			})
+
+			It("reads the workspace's package.json", func() {
+				Expect(finalizer.ReadPackageJSON()).To(Succeed())
+				Expect(finalizer.StartScript).To(Equal("api-start"))
+			})
+		})
 	})
 
 	Describe("CopyProfileScripts", func() {
@@ -111,18 +137,34 @@ var _ = Describe("Finalize", func() {
 			Expect(ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "other.sh"))).To(Equal([]byte("more Text")))
 		})
 
-		It("Copies ruby scripts from <buildpack_dir>/profile to <dep_dir>/scripts", func() {
+		It("does not run ruby scripts at launch", func() {
 			Expect(finalizer.CopyProfileScripts()).To(Succeed())
-			Expect(ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "scripts", "test.rb"))).To(Equal([]byte("Ruby Text")))
-			Expect(filepath.Join(depsDir, depsIdx, "profile.d", "test.rb")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(depsDir, depsIdx, "profile.d", "test.rb.sh")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(depsDir, depsIdx, "scripts")).NotTo(BeAnExistingFile())
 		})
 
-		It("Creates a profile.d file to source the ruby script", func() {
+		It("does nothing without a profile directory", func() {
+			Expect(os.RemoveAll(filepath.Join(buildpackDir, "profile"))).To(Succeed())
 			Expect(finalizer.CopyProfileScripts()).To(Succeed())
-			expected := "eval $(ruby $DEPS_DIR/9/scripts/test.rb)\n"
-			actual, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "test.rb.sh"))
-			Expect(err).ToNot(HaveOccurred())
-			Expect(string(actual)).To(Equal(expected))
+			Expect(filepath.Join(depsDir, depsIdx, "profile.d")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Describe("InstallLaunchHelper", func() {
+		It("copies the helper into the dep dir", func() {
+			helper := filepath.Join(buildDir, "launch-env")
+			Expect(ioutil.WriteFile(helper, []byte("binary"), 0644)).To(Succeed())
+			finalizer.LaunchHelper = helper
+
+			Expect(finalizer.InstallLaunchHelper()).To(Succeed())
+			info, err := os.Stat(filepath.Join(depsDir, depsIdx, "launch-env"))
+			Expect(err).To(BeNil())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+		})
+
+		It("does nothing without a helper", func() {
+			Expect(finalizer.InstallLaunchHelper()).To(Succeed())
+			Expect(filepath.Join(depsDir, depsIdx, "launch-env")).NotTo(BeAnExistingFile())
 		})
 	})
 
@@ -149,6 +191,17 @@ var _ = Describe("Finalize", func() {
 			})
 		})
 
+		Context("buildpack.yml sets a start_command", func() {
+			BeforeEach(func() {
+				finalizer.Config.StartCommand = "node dist/app.js"
+			})
+
+			It("Doesn't log a warning", func() {
+				Expect(finalizer.WarnNoStart()).To(Succeed())
+				Expect(buffer.String()).To(Equal(""))
+			})
+		})
+
 		Context("server.js exists", func() {
 			BeforeEach(func() {
 				Expect(ioutil.WriteFile(filepath.Join(buildDir, "server.js"), []byte("xxx"), 0644)).To(Succeed())
@@ -168,4 +221,36 @@ var _ = Describe("Finalize", func() {
 			})
 		})
 	})
+
+	Describe("WriteSBOM", func() {
+		var bom sbom.BOM
+
+		BeforeEach(func() {
+			depDir := filepath.Join(depsDir, depsIdx)
+			mockManifest.EXPECT().Version().Return("1.6.40", nil)
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"name": "my-app", "version": "2.0.0"}`), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(depDir, "staging_report.json"), []byte(`{"tools": {"node": {"version": "10.16.0", "source": "default"}, "npm": {"version": "6.9.0", "source": "default"}}}`), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(depDir, "node_modules", "express"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(depDir, "node_modules", "express", "package.json"), []byte(`{"name": "express", "version": "4.16.3", "license": "MIT"}`), 0644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(buildDir, "node_modules", "@hook", "agent"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "node_modules", "@hook", "agent", "package.json"), []byte(`{"name": "@hook/agent", "version": "1.0.0"}`), 0644)).To(Succeed())
+
+			Expect(finalizer.WriteSBOM()).To(Succeed())
+			Expect(libbuildpack.NewJSON().Load(filepath.Join(depDir, "sbom.cdx.json"), &bom)).To(Succeed())
+		})
+
+		It("describes the app", func() {
+			Expect(bom.Metadata.Component.Name).To(Equal("my-app"))
+			Expect(bom.Metadata.Tools[0].Version).To(Equal("1.6.40"))
+			Expect(buffer.String()).To(ContainSubstring("Writing sbom.cdx.json (2 packages)"))
+		})
+
+		It("lists node, npm, and the installed packages, including ones added by hooks", func() {
+			var purls []string
+			for _, component := range bom.Components {
+				purls = append(purls, component.PURL)
+			}
+			Expect(purls).To(Equal([]string{"pkg:generic/node@10.16.0", "pkg:npm/npm@6.9.0", "pkg:npm/%40hook/agent@1.0.0", "pkg:npm/express@4.16.3"}))
+		})
+	})
 })
@@ -44,6 +44,19 @@ func (mr *MockManifestMockRecorder) RootDir() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RootDir", reflect.TypeOf((*MockManifest)(nil).RootDir))
 }
 
+// Version mocks base method
+func (m *MockManifest) Version() (string, error) {
+	ret := m.ctrl.Call(m, "Version")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Version indicates an expected call of Version
+func (mr *MockManifestMockRecorder) Version() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Version", reflect.TypeOf((*MockManifest)(nil).Version))
+}
+
 // MockStager is a mock of Stager interface
 type MockStager struct {
 	ctrl     *gomock.Controller
@@ -90,15 +103,3 @@ func (m *MockStager) DepDir() string {
 func (mr *MockStagerMockRecorder) DepDir() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DepDir", reflect.TypeOf((*MockStager)(nil).DepDir))
 }
-
-// DepsIdx mocks base method
-func (m *MockStager) DepsIdx() string {
-	ret := m.ctrl.Call(m, "DepsIdx")
-	ret0, _ := ret[0].(string)
-	return ret0
-}
-
-// DepsIdx indicates an expected call of DepsIdx
-func (mr *MockStagerMockRecorder) DepsIdx() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DepsIdx", reflect.TypeOf((*MockStager)(nil).DepsIdx))
-}
@@ -0,0 +1,300 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"nodejs/config"
+	"nodejs/inventory"
+	"nodejs/launch"
+	"nodejs/report"
+	"nodejs/workspace"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// AppDynamicsHook configures the AppDynamics Node.js agent for a bound
+// AppDynamics service. It checks the credentials while staging, where a
+// mistake fails the push instead of leaving an app that silently reports
+// nowhere, and writes the names the agent reports under into
+// profile.d/appdynamics.sh. The controller and account are exported by the
+// launch helper when the app starts, from the service staging chose.
+type AppDynamicsHook struct {
+	libbuildpack.DefaultHook
+	Log *libbuildpack.Logger
+}
+
+type AppDynamicsCredentials struct {
+	ServiceName      string
+	HostName         string
+	Port             string
+	SslEnabled       string
+	AccountName      string
+	AccountAccessKey string
+	ApplicationName  string
+	TierName         string
+	NodeName         string
+}
+
+const appDynamicsRequireFile = "appdynamics-require.js"
+
+// appDynamicsRequire starts the agent from NODE_OPTIONS --require, before the
+// app's own code, with the settings profile.d/appdynamics.sh exports.
+const appDynamicsRequire = `require('appdynamics').profile({
+  controllerHostName: process.env.APPDYNAMICS_CONTROLLER_HOST_NAME,
+  controllerPort: process.env.APPDYNAMICS_CONTROLLER_PORT,
+  controllerSslEnabled: process.env.APPDYNAMICS_CONTROLLER_SSL_ENABLED === 'true',
+  accountName: process.env.APPDYNAMICS_AGENT_ACCOUNT_NAME,
+  accountAccessKey: process.env.APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY,
+  applicationName: process.env.APPDYNAMICS_AGENT_APPLICATION_NAME,
+  tierName: process.env.APPDYNAMICS_AGENT_TIER_NAME,
+  nodeName: process.env.APPDYNAMICS_AGENT_NODE_NAME
+});
+`
+
+var appDynamicsService = regexp.MustCompile(`app-?dynamics`)
+
+func init() {
+	logger := libbuildpack.NewLogger(output)
+
+	libbuildpack.AddHook(AppDynamicsHook{
+		Log: logger,
+	})
+}
+
+func (h AppDynamicsHook) AfterCompile(stager *libbuildpack.Stager) error {
+	h.Log.Debug("Checking for enabled AppDynamics service...")
+
+	if enabled, err := config.HookEnabled(stager.BuildDir(), "appdynamics"); err != nil {
+		return err
+	} else if !enabled {
+		h.Log.Debug("AppDynamics hook disabled in buildpack.yml")
+		return nil
+	}
+
+	credentials, found, err := h.credentials()
+	if err != nil {
+		return err
+	} else if !found {
+		h.Log.Debug("AppDynamics service not found")
+		return nil
+	}
+
+	h.Log.BeginStep("Setting up AppDynamics agent for service %s", credentials.ServiceName)
+	if err := report.AddHook(stager.DepDir(), "appdynamics"); err != nil {
+		return err
+	}
+	if err := launch.AddService(stager.DepDir(), "appdynamics", credentials.ServiceName); err != nil {
+		return err
+	}
+
+	script := h.profileScript(credentials)
+
+	if autoRequire := os.Getenv("APPDYNAMICS_AUTO_REQUIRE"); autoRequire != "" {
+		enabled, err := strconv.ParseBool(autoRequire)
+		if err != nil {
+			return fmt.Errorf("APPDYNAMICS_AUTO_REQUIRE must be true or false, not %s", autoRequire)
+		}
+		if enabled {
+			if installed, err := moduleInstalled(stager, "appdynamics"); err != nil {
+				return err
+			} else if !installed {
+				h.Log.Warning("APPDYNAMICS_AUTO_REQUIRE is set, but the appdynamics module is not in node_modules. Add it to the app's dependencies so the agent can start.")
+			} else {
+				if err := ioutil.WriteFile(filepath.Join(stager.DepDir(), appDynamicsRequireFile), []byte(appDynamicsRequire), 0644); err != nil {
+					return err
+				}
+				requirePath := filepath.Join("$DEPS_DIR", stager.DepsIdx(), appDynamicsRequireFile)
+				script += fmt.Sprintf("export NODE_OPTIONS=\"${NODE_OPTIONS:+$NODE_OPTIONS }--require %s\"\n", requirePath)
+				h.Log.Info("The agent is required before the app starts")
+			}
+		}
+	}
+
+	if err := stager.WriteProfileD("appdynamics.sh", script); err != nil {
+		return err
+	}
+
+	h.Log.Info("AppDynamics agent reports to %s as %s", credentials.HostName, credentials.ApplicationName)
+	return nil
+}
+
+// profileScript exports the names the agent reports under in a fixed order,
+// so the script only changes when they do. Variables set on the app win.
+func (h AppDynamicsHook) profileScript(credentials AppDynamicsCredentials) string {
+	var script string
+	for _, setting := range []struct {
+		name  string
+		value string
+	}{
+		{"APPDYNAMICS_AGENT_APPLICATION_NAME", credentials.ApplicationName},
+		{"APPDYNAMICS_AGENT_TIER_NAME", credentials.TierName},
+	} {
+		if setting.value != "" {
+			script += fmt.Sprintf("export %s=${%s:-%s}\n", setting.name, setting.name, launch.Quote(setting.value))
+		}
+	}
+	// Each instance reports as its own node.
+	script += fmt.Sprintf("export APPDYNAMICS_AGENT_NODE_NAME=${APPDYNAMICS_AGENT_NODE_NAME:-%s:${CF_INSTANCE_INDEX:-0}}\n", launch.Quote(credentials.NodeName))
+	return script
+}
+
+// credentials finds the service labelled, named or tagged appdynamics or
+// app-dynamics, and checks it has what the agent needs to connect. With more
+// than one, the one labelled appdynamics is used, as before the hook.
+func (h AppDynamicsHook) credentials() (AppDynamicsCredentials, bool, error) {
+	type Service struct {
+		Name        string                 `json:"name"`
+		Label       string                 `json:"label"`
+		Tags        []string               `json:"tags"`
+		Credentials map[string]interface{} `json:"credentials"`
+	}
+
+	var vcapServices map[string][]Service
+	if err := json.Unmarshal([]byte(os.Getenv("VCAP_SERVICES")), &vcapServices); err != nil {
+		h.Log.Debug("Failed to unmarshal VCAP_SERVICES: %s", err)
+		return AppDynamicsCredentials{}, false, nil
+	}
+
+	var labels []string
+	for label := range vcapServices {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i] == "appdynamics" && labels[j] != "appdynamics"
+	})
+
+	var matches []Service
+	for _, label := range labels {
+		for _, service := range vcapServices[label] {
+			keywords := append([]string{label, service.Name, service.Label}, service.Tags...)
+			for _, keyword := range keywords {
+				if appDynamicsService.MatchString(strings.ToLower(keyword)) {
+					matches = append(matches, service)
+					break
+				}
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return AppDynamicsCredentials{}, false, nil
+	} else if len(matches) > 1 {
+		var names []string
+		for _, service := range matches {
+			names = append(names, service.Name)
+		}
+		h.Log.Warning("More than one AppDynamics service found (%s), using %s", strings.Join(names, ", "), matches[0].Name)
+	}
+
+	service := matches[0]
+	credential := func(key string) string {
+		switch value := service.Credentials[key].(type) {
+		case string:
+			return value
+		case nil:
+			return ""
+		default:
+			return fmt.Sprint(value)
+		}
+	}
+
+	appName := h.appName()
+	credentials := AppDynamicsCredentials{
+		ServiceName:      service.Name,
+		HostName:         credential("host-name"),
+		Port:             credential("port"),
+		SslEnabled:       credential("ssl-enabled"),
+		AccountName:      credential("account-name"),
+		AccountAccessKey: credential("account-access-key"),
+		ApplicationName:  credential("application-name"),
+		TierName:         credential("tier-name"),
+		NodeName:         credential("node-name"),
+	}
+	if credentials.ApplicationName == "" {
+		credentials.ApplicationName = appName
+	}
+	if credentials.TierName == "" {
+		credentials.TierName = appName
+	}
+	if credentials.NodeName == "" {
+		credentials.NodeName = appName
+	}
+
+	var missing []string
+	for _, required := range []struct {
+		key   string
+		value string
+	}{
+		{"host-name", credentials.HostName},
+		{"account-name", credentials.AccountName},
+		{"account-access-key", credentials.AccountAccessKey},
+	} {
+		if required.value == "" {
+			missing = append(missing, required.key)
+		}
+	}
+	if len(missing) > 0 {
+		return credentials, false, fmt.Errorf("AppDynamics service %s has no %s", service.Name, strings.Join(missing, ", "))
+	}
+	if credentials.Port != "" {
+		if port, err := strconv.Atoi(credentials.Port); err != nil || port < 1 || port > 65535 {
+			return credentials, false, fmt.Errorf("AppDynamics service %s has port %s, which is not a port number", service.Name, credentials.Port)
+		}
+	}
+	if credentials.SslEnabled != "" {
+		enabled, err := strconv.ParseBool(credentials.SslEnabled)
+		if err != nil {
+			return credentials, false, fmt.Errorf("AppDynamics service %s has ssl-enabled %s, which must be true or false", service.Name, credentials.SslEnabled)
+		}
+		credentials.SslEnabled = strconv.FormatBool(enabled)
+	}
+
+	return credentials, true, nil
+}
+
+func (h AppDynamicsHook) appName() string {
+	var application struct {
+		Name string `json:"application_name"`
+	}
+	if err := json.Unmarshal([]byte(os.Getenv("VCAP_APPLICATION")), &application); err != nil {
+		return ""
+	}
+	return application.Name
+}
+
+// moduleInstalled looks for a module wherever staging left node_modules,
+// which by the time the hooks run has usually been moved into the dep dir.
+func moduleInstalled(stager *libbuildpack.Stager, module string) (bool, error) {
+	dir, err := appDir(stager.BuildDir())
+	if err != nil {
+		return false, err
+	}
+	for _, nodeModules := range inventory.NodeModulesDirs(stager.BuildDir(), stager.DepDir(), dir) {
+		if installed, err := libbuildpack.FileExists(filepath.Join(nodeModules, module, "package.json")); err != nil || installed {
+			return installed, err
+		}
+	}
+	return false, nil
+}
+
+// appDir is the directory of the workspace staged as the app, relative to
+// buildDir, or "" for the app root.
+func appDir(buildDir string) (string, error) {
+	cfg, err := config.Load(buildDir)
+	if err != nil {
+		return "", err
+	}
+	ws, err := workspace.Selected(buildDir, cfg.Workspace)
+	if err != nil {
+		return "", err
+	}
+	return ws.Dir, nil
+}
@@ -0,0 +1,306 @@
+package hooks_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"bytes"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	"nodejs/hooks"
+	"nodejs/launch"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("appdynamicsHook", func() {
+	var (
+		err         error
+		buildDir    string
+		depsDir     string
+		depsIdx     string
+		logger      *libbuildpack.Logger
+		stager      *libbuildpack.Stager
+		buffer      *bytes.Buffer
+		appdynamics hooks.AppDynamicsHook
+	)
+
+	profileScript := func() string {
+		contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "appdynamics.sh"))
+		Expect(err).To(BeNil())
+		return string(contents)
+	}
+
+	services := func() map[string]string {
+		services, err := launch.ReadServices(filepath.Join(depsDir, depsIdx))
+		Expect(err).To(BeNil())
+		return services
+	}
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+
+		depsDir, err = ioutil.TempDir("", "nodejs-buildpack.deps.")
+		Expect(err).To(BeNil())
+
+		depsIdx = "07"
+		Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+
+		appdynamics = hooks.AppDynamicsHook{
+			Log: logger,
+		}
+	})
+
+	JustBeforeEach(func() {
+		args := []string{buildDir, "", depsDir, depsIdx}
+		stager = libbuildpack.NewStager(args, logger, &libbuildpack.Manifest{})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	Describe("AfterCompile", func() {
+		var (
+			oldVcapApplication string
+			oldVcapServices    string
+			oldAutoRequire     string
+		)
+
+		BeforeEach(func() {
+			oldVcapApplication = os.Getenv("VCAP_APPLICATION")
+			oldVcapServices = os.Getenv("VCAP_SERVICES")
+			oldAutoRequire = os.Getenv("APPDYNAMICS_AUTO_REQUIRE")
+
+			os.Setenv("VCAP_APPLICATION", `{"application_name":"JimBob"}`)
+			os.Setenv("APPDYNAMICS_AUTO_REQUIRE", "")
+		})
+
+		AfterEach(func() {
+			os.Setenv("VCAP_APPLICATION", oldVcapApplication)
+			os.Setenv("VCAP_SERVICES", oldVcapServices)
+			os.Setenv("APPDYNAMICS_AUTO_REQUIRE", oldAutoRequire)
+		})
+
+		Context("VCAP_SERVICES has no appdynamics service", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{"0": [{"name":"mysql"}], "1": [{"name":"redis"}]}`)
+			})
+
+			It("does nothing and succeeds", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(buffer.String()).To(Equal(""))
+				Expect(filepath.Join(depsDir, depsIdx, "profile.d", "appdynamics.sh")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("VCAP_SERVICES has an appdynamics service", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"appdynamics": [{"name":"appd","label":"appdynamics","credentials":{"host-name":"controller","port":443,"ssl-enabled":true,"account-name":"acct","account-access-key":"secret"}}]
+				}`)
+			})
+
+			It("writes the names the agent reports under to a profile script", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(profileScript()).To(Equal(`export APPDYNAMICS_AGENT_APPLICATION_NAME=${APPDYNAMICS_AGENT_APPLICATION_NAME:-'JimBob'}
+export APPDYNAMICS_AGENT_TIER_NAME=${APPDYNAMICS_AGENT_TIER_NAME:-'JimBob'}
+export APPDYNAMICS_AGENT_NODE_NAME=${APPDYNAMICS_AGENT_NODE_NAME:-'JimBob':${CF_INSTANCE_INDEX:-0}}
+`))
+				Expect(buffer.String()).To(ContainSubstring("Setting up AppDynamics agent for service appd"))
+			})
+
+			It("leaves the controller and account to the launch helper", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(services()).To(Equal(map[string]string{"appdynamics": "appd"}))
+				Expect(profileScript()).NotTo(ContainSubstring("secret"))
+			})
+
+			It("writes the same script every time", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				first := profileScript()
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(profileScript()).To(Equal(first))
+			})
+
+			It("adds the hook to the staging report", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "staging_report.json"))
+				Expect(err).To(BeNil())
+				Expect(string(contents)).To(ContainSubstring(`"appdynamics"`))
+			})
+		})
+
+		Context("a user-provided service is named app-dynamics", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"user-provided": [{"name":"app-dynamics","label":"user-provided","credentials":{"host-name":"ups-host","account-name":"acct","account-access-key":"secret"}}]
+				}`)
+			})
+
+			It("uses it", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(services()).To(Equal(map[string]string{"appdynamics": "app-dynamics"}))
+			})
+		})
+
+		Context("a service is tagged appdynamics", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"apm": [{"name":"monitoring","label":"apm","tags":["AppDynamics"],"credentials":{"host-name":"tagged-host","account-name":"acct","account-access-key":"secret"}}]
+				}`)
+			})
+
+			It("uses it", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(services()).To(Equal(map[string]string{"appdynamics": "monitoring"}))
+			})
+		})
+
+		Context("the credentials override the names", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"appdynamics": [{"name":"appd","credentials":{"host-name":"controller","account-name":"acct","account-access-key":"secret","application-name":"shop","tier-name":"checkout","node-name":"checkout-node"}}]
+				}`)
+			})
+
+			It("uses them", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(profileScript()).To(ContainSubstring("APPDYNAMICS_AGENT_APPLICATION_NAME:-'shop'"))
+				Expect(profileScript()).To(ContainSubstring("APPDYNAMICS_AGENT_TIER_NAME:-'checkout'"))
+				Expect(profileScript()).To(ContainSubstring("APPDYNAMICS_AGENT_NODE_NAME:-'checkout-node':${CF_INSTANCE_INDEX:-0}"))
+			})
+		})
+
+		Context("a name contains a quote", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"appdynamics": [{"name":"appd","credentials":{"host-name":"controller","account-name":"acct","account-access-key":"secret","application-name":"it's"}}]
+				}`)
+			})
+
+			It("quotes it for the shell", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(profileScript()).To(ContainSubstring(`APPDYNAMICS_AGENT_APPLICATION_NAME:-'it'\''s'`))
+			})
+		})
+
+		Context("the credentials are incomplete", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"appdynamics": [{"name":"appd","credentials":{"host-name":"controller"}}]
+				}`)
+			})
+
+			It("fails staging naming what is missing", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(MatchError("AppDynamics service appd has no account-name, account-access-key"))
+				Expect(filepath.Join(depsDir, depsIdx, "profile.d", "appdynamics.sh")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("the port is not a number", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"appdynamics": [{"name":"appd","credentials":{"host-name":"controller","port":"https","account-name":"acct","account-access-key":"secret"}}]
+				}`)
+			})
+
+			It("fails staging", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(MatchError("AppDynamics service appd has port https, which is not a port number"))
+			})
+		})
+
+		Context("more than one appdynamics service is bound", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"user-provided": [{"name":"app-dynamics","credentials":{}}],
+					"appdynamics": [{"name":"appd","credentials":{"host-name":"controller","account-name":"acct","account-access-key":"secret"}}]
+				}`)
+			})
+
+			It("warns and uses the appdynamics service", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("More than one AppDynamics service found (appd, app-dynamics), using appd"))
+				Expect(services()).To(Equal(map[string]string{"appdynamics": "appd"}))
+			})
+		})
+
+		Context("the hook is disabled in buildpack.yml", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"appdynamics": [{"name":"appd","credentials":{"host-name":"controller","account-name":"acct","account-access-key":"secret"}}]
+				}`)
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("nodejs:\n  hooks:\n    appdynamics: false\n"), 0644)).To(Succeed())
+			})
+
+			It("does nothing", func() {
+				Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+				Expect(filepath.Join(depsDir, depsIdx, "profile.d", "appdynamics.sh")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("APPDYNAMICS_AUTO_REQUIRE is set", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"appdynamics": [{"name":"appd","credentials":{"host-name":"controller","account-name":"acct","account-access-key":"secret"}}]
+				}`)
+				os.Setenv("APPDYNAMICS_AUTO_REQUIRE", "true")
+			})
+
+			Context("the appdynamics module is installed", func() {
+				BeforeEach(func() {
+					Expect(os.MkdirAll(filepath.Join(buildDir, "node_modules", "appdynamics"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "node_modules", "appdynamics", "package.json"), []byte(`{"name":"appdynamics"}`), 0644)).To(Succeed())
+				})
+
+				It("requires the agent before the app starts", func() {
+					Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+					Expect(profileScript()).To(ContainSubstring(`export NODE_OPTIONS="${NODE_OPTIONS:+$NODE_OPTIONS }--require $DEPS_DIR/07/appdynamics-require.js"`))
+
+					contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "appdynamics-require.js"))
+					Expect(err).To(BeNil())
+					Expect(string(contents)).To(ContainSubstring("require('appdynamics').profile({"))
+				})
+			})
+
+			Context("the appdynamics module was moved into the dep dir", func() {
+				BeforeEach(func() {
+					Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx, "node_modules", "appdynamics"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(depsDir, depsIdx, "node_modules", "appdynamics", "package.json"), []byte(`{"name":"appdynamics"}`), 0644)).To(Succeed())
+				})
+
+				It("finds it and requires the agent", func() {
+					Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+					Expect(buffer.String()).NotTo(ContainSubstring("WARNING"))
+					Expect(profileScript()).To(ContainSubstring("--require $DEPS_DIR/07/appdynamics-require.js"))
+				})
+			})
+
+			Context("the appdynamics module is not installed", func() {
+				It("warns and leaves NODE_OPTIONS alone", func() {
+					Expect(appdynamics.AfterCompile(stager)).To(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("the appdynamics module is not in node_modules"))
+					Expect(profileScript()).NotTo(ContainSubstring("NODE_OPTIONS"))
+				})
+			})
+
+			Context("it is not a boolean", func() {
+				BeforeEach(func() {
+					os.Setenv("APPDYNAMICS_AUTO_REQUIRE", "sometimes")
+				})
+
+				It("fails staging", func() {
+					Expect(appdynamics.AfterCompile(stager)).To(MatchError("APPDYNAMICS_AUTO_REQUIRE must be true or false, not sometimes"))
+				})
+			})
+		})
+	})
+})
@@ -3,9 +3,13 @@ package hooks
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"nodejs/arch"
+	"nodejs/config"
+	"nodejs/report"
 	"os"
 	"path/filepath"
 	"strings"
@@ -28,10 +32,23 @@ type DynatraceHook struct {
 	libbuildpack.DefaultHook
 	Log     *libbuildpack.Logger
 	Command Command
+	// Arch is the architecture to install the agent for, the one staging
+	// runs on when empty.
+	Arch string
+}
+
+// dynatraceArchitectures maps an architecture to the installer's arch
+// parameter and the names its manifest.json may file the process agent under.
+var dynatraceArchitectures = map[string]struct {
+	param string
+	names []string
+}{
+	"amd64": {"x86", []string{"linux-x86-64"}},
+	"arm64": {"arm", []string{"linux-arm-64", "linux-aarch64"}},
 }
 
 func init() {
-	logger := libbuildpack.NewLogger(os.Stdout)
+	logger := libbuildpack.NewLogger(output)
 	command := &libbuildpack.Command{}
 
 	libbuildpack.AddHook(DynatraceHook{
@@ -43,6 +60,13 @@ func init() {
 func (h DynatraceHook) AfterCompile(stager *libbuildpack.Stager) error {
 	h.Log.Debug("Checking for enabled dynatrace service...")
 
+	if enabled, err := config.HookEnabled(stager.BuildDir(), "dynatrace"); err != nil {
+		return err
+	} else if !enabled {
+		h.Log.Debug("Dynatrace hook disabled in buildpack.yml")
+		return nil
+	}
+
 	credentials, found := h.dtCredentials()
 	if !found {
 		h.Log.Debug("Dynatrace service credentials not found!")
@@ -50,6 +74,9 @@ func (h DynatraceHook) AfterCompile(stager *libbuildpack.Stager) error {
 	}
 
 	h.Log.Info("Dynatrace service credentials found. Setting up Dynatrace PaaS agent.")
+	if err := report.AddHook(stager.DepDir(), "dynatrace"); err != nil {
+		return err
+	}
 
 	apiurl := credentials.ApiURL
 	if apiurl == "" {
@@ -57,6 +84,12 @@ func (h DynatraceHook) AfterCompile(stager *libbuildpack.Stager) error {
 	}
 
 	url := apiurl + "/v1/deployment/installer/agent/unix/paas-sh/latest?include=nodejs&include=process&bitness=64&Api-Token=" + credentials.ApiToken
+	if target := h.arch(); target != "amd64" {
+		if _, supported := dynatraceArchitectures[target]; !supported {
+			return fmt.Errorf("no Dynatrace agent for %s", target)
+		}
+		url += "&arch=" + dynatraceArchitectures[target].param
+	}
 	installerPath := filepath.Join(os.TempDir(), "paasInstaller.sh")
 
 	h.Log.Debug("Downloading '%s' to '%s'", url, installerPath)
@@ -256,11 +289,20 @@ func (h DynatraceHook) agentPath(installDir string) (string, error) {
 		return "", err
 	}
 
-	for _, binary := range manifest.Tech["process"]["linux-x86-64"] {
-		if binary.Binarytype ==	"primary" {
-			return binary.Path, nil
+	for _, name := range dynatraceArchitectures[h.arch()].names {
+		for _, binary := range manifest.Tech["process"][name] {
+			if binary.Binarytype == "primary" {
+				return binary.Path, nil
+			}
 		}
 	}
 
 	return "", errors.New("No primary binary for process agent found!")
 }
+
+func (h DynatraceHook) arch() string {
+	if h.Arch != "" {
+		return arch.Normalize(h.Arch)
+	}
+	return arch.Current()
+}
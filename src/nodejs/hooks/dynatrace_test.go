@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"bytes"
 
@@ -54,6 +55,7 @@ var _ = Describe("dynatraceHook", func() {
 		dynatrace = hooks.DynatraceHook{
 			Command: mockCommand,
 			Log:     logger,
+			Arch:    "amd64",
 		}
 
 		httpmock.Reset()
@@ -207,6 +209,53 @@ var _ = Describe("dynatraceHook", func() {
 			})
 		})
 
+		Context("staging runs on arm64", func() {
+			BeforeEach(func() {
+				apiToken := "ExcitingToken28"
+				os.Setenv("VCAP_APPLICATION", `{"name":"JimBob"}`)
+				os.Setenv("VCAP_SERVICES", `{
+					"0": [{"name":"dynatrace","credentials":{"apiurl":"https://example.com","apitoken":"`+apiToken+`","environmentid":"123456"}}]
+				}`)
+				dynatrace.Arch = "aarch64"
+
+				httpmock.RegisterResponder("GET", "https://example.com/v1/deployment/installer/agent/unix/paas-sh/latest?include=nodejs&include=process&bitness=64&Api-Token="+apiToken+"&arch=arm",
+					httpmock.NewStringResponder(200, "echo Install Dynatrace"))
+			})
+
+			It("installs the arm agent", func() {
+				mockCommand.EXPECT().Execute("", gomock.Any(), gomock.Any(), gomock.Any(), buildDir).Do(func(dir string, stdout, stderr io.Writer, file string, arg string) {
+					runInstaller(dir, stdout, stderr, file, arg)
+					manifestPath := filepath.Join(buildDir, "dynatrace/oneagent/manifest.json")
+					manifestJson, err := ioutil.ReadFile(manifestPath)
+					Expect(err).To(BeNil())
+					Expect(ioutil.WriteFile(manifestPath, []byte(strings.Replace(string(manifestJson), "linux-x86-64", "linux-arm-64", -1)), 0664)).To(Succeed())
+				})
+
+				Expect(dynatrace.AfterCompile(stager)).To(Succeed())
+
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "dynatrace-env.sh"))
+				Expect(err).To(BeNil())
+				Expect(string(contents)).To(ContainSubstring("export LD_PRELOAD=${HOME}/dynatrace/oneagent/agent/lib64/liboneagentproc.so"))
+			})
+		})
+
+		Context("the hook is disabled in buildpack.yml", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_APPLICATION", `{"name":"JimBob"}`)
+				os.Setenv("VCAP_SERVICES", `{
+					"0": [{"name":"dynatrace","credentials":{"apiurl":"https://example.com","apitoken":"ExcitingToken28","environmentid":"123456"}}]
+				}`)
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("nodejs:\n  hooks:\n    dynatrace: false\n"), 0644)).To(Succeed())
+			})
+
+			It("does nothing and succeeds", func() {
+				err = dynatrace.AfterCompile(stager)
+				Expect(err).To(BeNil())
+
+				Expect(buffer.String()).To(Equal(""))
+			})
+		})
+
 		Context("VCAP_SERVICES contains malformed dynatrace service", func() {
 			BeforeEach(func() {
 				environmentid := "123456"
@@ -0,0 +1,298 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"nodejs/config"
+	"nodejs/launch"
+	"nodejs/report"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// NewRelicHook configures the New Relic Node.js agent for a bound New Relic
+// service while staging, where the developer reads the warnings: it exports
+// the agent's settings from profile.d/newrelic.sh, points out a missing
+// newrelic dependency, and writes a newrelic.js if the app has none. The
+// license key and collector are exported by the launch helper when the app
+// starts, from the service staging chose.
+type NewRelicHook struct {
+	libbuildpack.DefaultHook
+	Log *libbuildpack.Logger
+}
+
+type NewRelicCredentials struct {
+	ServiceName        string
+	LicenseKey         string
+	AppName            string
+	CollectorHost      string
+	ProxyURL           string
+	Labels             string
+	DistributedTracing string
+	SpanEvents         string
+}
+
+// newRelicConfig is the newrelic.js written for apps without one. The
+// agent reads its settings from the NEW_RELIC_* variables, which take
+// precedence over this file anyway; it only sends the agent's log to stdout,
+// where cf logs shows it.
+const newRelicConfig = `'use strict'
+
+// Written by the Node.js buildpack because the app has no newrelic.js. The
+// agent is configured from the NEW_RELIC_* variables the buildpack exports
+// from the bound service; ship your own newrelic.js to change anything else.
+exports.config = {
+  app_name: [process.env.NEW_RELIC_APP_NAME],
+  license_key: process.env.NEW_RELIC_LICENSE_KEY,
+  logging: {
+    level: 'info',
+    filepath: 'stdout'
+  }
+}
+`
+
+func init() {
+	logger := libbuildpack.NewLogger(output)
+
+	libbuildpack.AddHook(NewRelicHook{
+		Log: logger,
+	})
+}
+
+func (h NewRelicHook) AfterCompile(stager *libbuildpack.Stager) error {
+	h.Log.Debug("Checking for enabled New Relic service...")
+
+	if enabled, err := config.HookEnabled(stager.BuildDir(), "newrelic"); err != nil {
+		return err
+	} else if !enabled {
+		h.Log.Debug("New Relic hook disabled in buildpack.yml")
+		return nil
+	}
+
+	credentials, found, err := h.credentials()
+	if err != nil {
+		return err
+	} else if !found {
+		h.Log.Debug("New Relic service not found")
+		return nil
+	}
+
+	h.Log.BeginStep("Setting up New Relic agent for service %s", credentials.ServiceName)
+	if err := report.AddHook(stager.DepDir(), "newrelic"); err != nil {
+		return err
+	}
+	if err := launch.AddService(stager.DepDir(), "newrelic", credentials.ServiceName); err != nil {
+		return err
+	}
+
+	// The agent looks for newrelic.js in the directory the app starts in,
+	// which is the staged workspace's.
+	dir, err := appDir(stager.BuildDir())
+	if err != nil {
+		return err
+	}
+	appRoot := filepath.Join(stager.BuildDir(), dir)
+
+	var pkg struct {
+		Type         string            `json:"type"`
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	if exists, err := libbuildpack.FileExists(filepath.Join(appRoot, "package.json")); err != nil {
+		return err
+	} else if exists {
+		if err := libbuildpack.NewJSON().Load(filepath.Join(appRoot, "package.json"), &pkg); err != nil {
+			return err
+		}
+	}
+	if _, found := pkg.Dependencies["newrelic"]; !found {
+		h.Log.Warning("A New Relic service is bound, but newrelic is not in the dependencies in package.json. Add it, and require('newrelic') first in the app, or the agent will not report.")
+	}
+
+	if err := h.writeConfig(appRoot, pkg.Type); err != nil {
+		return err
+	}
+
+	if err := stager.WriteProfileD("newrelic.sh", h.profileScript(credentials)); err != nil {
+		return err
+	}
+
+	h.Log.Info("New Relic agent reports as %s", credentials.AppName)
+	return nil
+}
+
+// writeConfig writes newrelic.js into appRoot unless the app ships a config
+// file. In an ES module package the agent can only load newrelic.cjs.
+func (h NewRelicHook) writeConfig(appRoot, packageType string) error {
+	for _, name := range []string{"newrelic.js", "newrelic.cjs"} {
+		if exists, err := libbuildpack.FileExists(filepath.Join(appRoot, name)); err != nil {
+			return err
+		} else if exists {
+			h.Log.Info("Using the app's %s", name)
+			return nil
+		}
+	}
+
+	name := "newrelic.js"
+	if packageType == "module" {
+		name = "newrelic.cjs"
+	}
+	h.Log.Info("Writing %s", name)
+	return ioutil.WriteFile(filepath.Join(appRoot, name), []byte(newRelicConfig), 0644)
+}
+
+// profileScript exports the agent settings other than the license key and
+// collector in a fixed order, so the script only changes when the settings
+// do. Variables set on the app win.
+func (h NewRelicHook) profileScript(credentials NewRelicCredentials) string {
+	var script string
+	for _, setting := range []struct {
+		name  string
+		value string
+	}{
+		{"NEW_RELIC_APP_NAME", credentials.AppName},
+		{"NEW_RELIC_LABELS", credentials.Labels},
+		{"NEW_RELIC_DISTRIBUTED_TRACING_ENABLED", credentials.DistributedTracing},
+		{"NEW_RELIC_SPAN_EVENTS_ENABLED", credentials.SpanEvents},
+	} {
+		if setting.value != "" {
+			script += fmt.Sprintf("export %s=${%s:-%s}\n", setting.name, setting.name, launch.Quote(setting.value))
+		}
+	}
+	return script
+}
+
+// credentials finds the service labelled, tagged or named newrelic. With more
+// than one, the one labelled newrelic is used, as before the hook.
+func (h NewRelicHook) credentials() (NewRelicCredentials, bool, error) {
+	type Service struct {
+		Name        string                 `json:"name"`
+		Label       string                 `json:"label"`
+		Tags        []string               `json:"tags"`
+		Credentials map[string]interface{} `json:"credentials"`
+	}
+
+	var vcapServices map[string][]Service
+	if err := json.Unmarshal([]byte(os.Getenv("VCAP_SERVICES")), &vcapServices); err != nil {
+		h.Log.Debug("Failed to unmarshal VCAP_SERVICES: %s", err)
+		return NewRelicCredentials{}, false, nil
+	}
+
+	var labels []string
+	for label := range vcapServices {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i] == "newrelic" && labels[j] != "newrelic"
+	})
+
+	var matches []Service
+	for _, label := range labels {
+		for _, service := range vcapServices[label] {
+			keywords := append([]string{label, service.Name, service.Label}, service.Tags...)
+			for _, keyword := range keywords {
+				if strings.Contains(strings.ToLower(keyword), "newrelic") {
+					matches = append(matches, service)
+					break
+				}
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return NewRelicCredentials{}, false, nil
+	} else if len(matches) > 1 {
+		var names []string
+		for _, service := range matches {
+			names = append(names, service.Name)
+		}
+		h.Log.Warning("More than one New Relic service found (%s), using %s", strings.Join(names, ", "), matches[0].Name)
+	}
+
+	service := matches[0]
+	credential := func(keys ...string) string {
+		for _, key := range keys {
+			switch value := service.Credentials[key].(type) {
+			case string:
+				if value != "" {
+					return value
+				}
+			case nil:
+			default:
+				return fmt.Sprint(value)
+			}
+		}
+		return ""
+	}
+
+	credentials := NewRelicCredentials{
+		ServiceName:   service.Name,
+		LicenseKey:    credential("licenseKey", "license_key"),
+		AppName:       credential("appName", "app_name"),
+		CollectorHost: credential("collector_host", "host"),
+		ProxyURL:      credential("proxy_url", "proxy"),
+		Labels:        newRelicLabels(service.Credentials["labels"]),
+	}
+	if credentials.LicenseKey == "" {
+		return credentials, false, fmt.Errorf("New Relic service %s has no licenseKey", service.Name)
+	}
+	if credentials.AppName == "" {
+		credentials.AppName = h.appName()
+	}
+
+	for _, flag := range []struct {
+		key   string
+		value *string
+	}{
+		{"distributed_tracing", &credentials.DistributedTracing},
+		{"span_events", &credentials.SpanEvents},
+	} {
+		value := credential(flag.key)
+		if value == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return credentials, false, fmt.Errorf("New Relic service %s has %s %s, which must be true or false", service.Name, flag.key, value)
+		}
+		*flag.value = strconv.FormatBool(enabled)
+	}
+
+	return credentials, true, nil
+}
+
+// appName is the name the agent reported under when the buildpack set it up
+// from a profile script: the app's name and id.
+func (h NewRelicHook) appName() string {
+	var application struct {
+		ID   string `json:"application_id"`
+		Name string `json:"application_name"`
+	}
+	if err := json.Unmarshal([]byte(os.Getenv("VCAP_APPLICATION")), &application); err != nil {
+		return ""
+	}
+	return application.Name + "_" + application.ID
+}
+
+// newRelicLabels renders labels given as an object in the agent's
+// "name:value;name:value" form. A string is passed on as it is.
+func newRelicLabels(labels interface{}) string {
+	switch labels := labels.(type) {
+	case string:
+		return labels
+	case map[string]interface{}:
+		var pairs []string
+		for name, value := range labels {
+			pairs = append(pairs, fmt.Sprintf("%s:%v", name, value))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ";")
+	}
+	return ""
+}
@@ -0,0 +1,288 @@
+package hooks_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"bytes"
+
+	"github.com/cloudfoundry/libbuildpack"
+
+	"nodejs/hooks"
+	"nodejs/launch"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("newrelicHook", func() {
+	var (
+		err      error
+		buildDir string
+		depsDir  string
+		depsIdx  string
+		logger   *libbuildpack.Logger
+		stager   *libbuildpack.Stager
+		buffer   *bytes.Buffer
+		newrelic hooks.NewRelicHook
+	)
+
+	profileScript := func() string {
+		contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "profile.d", "newrelic.sh"))
+		Expect(err).To(BeNil())
+		return string(contents)
+	}
+
+	services := func() map[string]string {
+		services, err := launch.ReadServices(filepath.Join(depsDir, depsIdx))
+		Expect(err).To(BeNil())
+		return services
+	}
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+
+		depsDir, err = ioutil.TempDir("", "nodejs-buildpack.deps.")
+		Expect(err).To(BeNil())
+
+		depsIdx = "07"
+		Expect(os.MkdirAll(filepath.Join(depsDir, depsIdx), 0755)).To(Succeed())
+
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"dependencies": {"newrelic": "^11.0.0"}}`), 0644)).To(Succeed())
+
+		buffer = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(buffer)
+
+		newrelic = hooks.NewRelicHook{
+			Log: logger,
+		}
+	})
+
+	JustBeforeEach(func() {
+		args := []string{buildDir, "", depsDir, depsIdx}
+		stager = libbuildpack.NewStager(args, logger, &libbuildpack.Manifest{})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	Describe("AfterCompile", func() {
+		var (
+			oldVcapApplication string
+			oldVcapServices    string
+		)
+
+		BeforeEach(func() {
+			oldVcapApplication = os.Getenv("VCAP_APPLICATION")
+			oldVcapServices = os.Getenv("VCAP_SERVICES")
+
+			os.Setenv("VCAP_APPLICATION", `{"application_id":"abc-123","application_name":"JimBob"}`)
+		})
+
+		AfterEach(func() {
+			os.Setenv("VCAP_APPLICATION", oldVcapApplication)
+			os.Setenv("VCAP_SERVICES", oldVcapServices)
+		})
+
+		Context("VCAP_SERVICES has no newrelic service", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{"0": [{"name":"mysql"}], "1": [{"name":"redis"}]}`)
+			})
+
+			It("does nothing and succeeds", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				Expect(buffer.String()).To(Equal(""))
+				Expect(filepath.Join(depsDir, depsIdx, "profile.d", "newrelic.sh")).NotTo(BeAnExistingFile())
+				Expect(filepath.Join(buildDir, "newrelic.js")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("VCAP_SERVICES has a newrelic service", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"newrelic": [{"name":"nr","label":"newrelic","credentials":{"licenseKey":"key1"}}]
+				}`)
+			})
+
+			It("exports the app name", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				Expect(profileScript()).To(Equal("export NEW_RELIC_APP_NAME=${NEW_RELIC_APP_NAME:-'JimBob_abc-123'}\n"))
+				Expect(buffer.String()).To(ContainSubstring("Setting up New Relic agent for service nr"))
+				Expect(buffer.String()).NotTo(ContainSubstring("WARNING"))
+			})
+
+			It("leaves the license key to the launch helper", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				Expect(services()).To(Equal(map[string]string{"newrelic": "nr"}))
+				Expect(profileScript()).NotTo(ContainSubstring("key1"))
+			})
+
+			It("writes newrelic.js", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(buildDir, "newrelic.js"))
+				Expect(err).To(BeNil())
+				Expect(string(contents)).To(ContainSubstring("license_key: process.env.NEW_RELIC_LICENSE_KEY"))
+				Expect(buffer.String()).To(ContainSubstring("Writing newrelic.js"))
+			})
+
+			It("adds the hook to the staging report", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				contents, err := ioutil.ReadFile(filepath.Join(depsDir, depsIdx, "staging_report.json"))
+				Expect(err).To(BeNil())
+				Expect(string(contents)).To(ContainSubstring(`"newrelic"`))
+			})
+
+			Context("the app ships newrelic.js", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "newrelic.js"), []byte("mine"), 0644)).To(Succeed())
+				})
+
+				It("keeps it", func() {
+					Expect(newrelic.AfterCompile(stager)).To(Succeed())
+					Expect(ioutil.ReadFile(filepath.Join(buildDir, "newrelic.js"))).To(Equal([]byte("mine")))
+					Expect(buffer.String()).To(ContainSubstring("Using the app's newrelic.js"))
+				})
+			})
+
+			Context("the app is an ES module package", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"type": "module", "dependencies": {"newrelic": "^11.0.0"}}`), 0644)).To(Succeed())
+				})
+
+				It("writes newrelic.cjs", func() {
+					Expect(newrelic.AfterCompile(stager)).To(Succeed())
+					Expect(filepath.Join(buildDir, "newrelic.cjs")).To(BeAnExistingFile())
+					Expect(filepath.Join(buildDir, "newrelic.js")).NotTo(BeAnExistingFile())
+				})
+			})
+
+			Context("newrelic is not in the dependencies", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"devDependencies": {"newrelic": "^11.0.0"}}`), 0644)).To(Succeed())
+				})
+
+				It("warns", func() {
+					Expect(newrelic.AfterCompile(stager)).To(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("A New Relic service is bound, but newrelic is not in the dependencies in package.json"))
+				})
+			})
+
+			Context("a workspace is staged", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"private": true, "workspaces": ["packages/*"]}`), 0644)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(buildDir, "packages", "api"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "packages", "api", "package.json"), []byte(`{"name": "api", "dependencies": {"newrelic": "^11.0.0"}}`), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("nodejs:\n  workspace: packages/api\n"), 0644)).To(Succeed())
+				})
+
+				It("checks the workspace's dependencies and writes newrelic.js next to them", func() {
+					Expect(newrelic.AfterCompile(stager)).To(Succeed())
+					Expect(buffer.String()).NotTo(ContainSubstring("WARNING"))
+					Expect(filepath.Join(buildDir, "packages", "api", "newrelic.js")).To(BeAnExistingFile())
+					Expect(filepath.Join(buildDir, "newrelic.js")).NotTo(BeAnExistingFile())
+				})
+			})
+		})
+
+		Context("a user-provided service is named like newrelic", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"user-provided": [{"name":"my-newrelic","label":"user-provided","credentials":{"licenseKey":"key2"}}]
+				}`)
+			})
+
+			It("uses it", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				Expect(services()).To(Equal(map[string]string{"newrelic": "my-newrelic"}))
+			})
+		})
+
+		Context("a service is tagged newrelic", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"apm": [{"name":"monitoring","label":"apm","tags":["NewRelic"],"credentials":{"license_key":"key3"}}]
+				}`)
+			})
+
+			It("uses it", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				Expect(services()).To(Equal(map[string]string{"newrelic": "monitoring"}))
+			})
+		})
+
+		Context("the service has extra credentials", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"newrelic": [{"name":"nr","credentials":{
+						"licenseKey":"key1",
+						"appName":"shop",
+						"collector_host":"collector.eu.newrelic.com",
+						"proxy_url":"http://proxy.example.com:3128",
+						"labels":{"team":"checkout","env":"prod"},
+						"distributed_tracing":true,
+						"span_events":"false"
+					}}]
+				}`)
+			})
+
+			It("exports them for the agent", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				Expect(profileScript()).To(Equal("export NEW_RELIC_APP_NAME=${NEW_RELIC_APP_NAME:-'shop'}\n" +
+					"export NEW_RELIC_LABELS=${NEW_RELIC_LABELS:-'env:prod;team:checkout'}\n" +
+					"export NEW_RELIC_DISTRIBUTED_TRACING_ENABLED=${NEW_RELIC_DISTRIBUTED_TRACING_ENABLED:-'true'}\n" +
+					"export NEW_RELIC_SPAN_EVENTS_ENABLED=${NEW_RELIC_SPAN_EVENTS_ENABLED:-'false'}\n"))
+			})
+		})
+
+		Context("the service has no license key", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{"newrelic": [{"name":"nr","credentials":{}}]}`)
+			})
+
+			It("fails staging", func() {
+				Expect(newrelic.AfterCompile(stager)).To(MatchError("New Relic service nr has no licenseKey"))
+			})
+		})
+
+		Context("a tracing flag is not a boolean", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{"newrelic": [{"name":"nr","credentials":{"licenseKey":"key1","distributed_tracing":"on-ish"}}]}`)
+			})
+
+			It("fails staging", func() {
+				Expect(newrelic.AfterCompile(stager)).To(MatchError("New Relic service nr has distributed_tracing on-ish, which must be true or false"))
+			})
+		})
+
+		Context("more than one newrelic service is bound", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{
+					"newrelic": [{"name":"nr","credentials":{"licenseKey":"key1"}}],
+					"user-provided": [{"name":"newrelic-ups","credentials":{"licenseKey":"key2"}}]
+				}`)
+			})
+
+			It("warns and uses the newrelic service", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("More than one New Relic service found (nr, newrelic-ups), using nr"))
+				Expect(services()).To(Equal(map[string]string{"newrelic": "nr"}))
+			})
+		})
+
+		Context("the hook is disabled in buildpack.yml", func() {
+			BeforeEach(func() {
+				os.Setenv("VCAP_SERVICES", `{"newrelic": [{"name":"nr","credentials":{"licenseKey":"key1"}}]}`)
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("nodejs:\n  hooks:\n    newrelic: false\n"), 0644)).To(Succeed())
+			})
+
+			It("does nothing", func() {
+				Expect(newrelic.AfterCompile(stager)).To(Succeed())
+				Expect(filepath.Join(depsDir, depsIdx, "profile.d", "newrelic.sh")).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+})
@@ -0,0 +1,25 @@
+package hooks
+
+import (
+	"io"
+	"os"
+)
+
+// output is where the hooks in this package log. Their loggers are made in
+// init, before supply and finalize have set up their own, so they write
+// through this and SetOutput points it elsewhere afterwards.
+var output = &redirect{w: os.Stdout}
+
+type redirect struct {
+	w io.Writer
+}
+
+func (r *redirect) Write(p []byte) (int, error) {
+	return r.w.Write(p)
+}
+
+// SetOutput sends the hooks' logging to w, such as the writer that also feeds
+// the logfile and the staging report.
+func SetOutput(w io.Writer) {
+	output.w = w
+}
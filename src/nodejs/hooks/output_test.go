@@ -0,0 +1,63 @@
+package hooks_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"nodejs/hooks"
+	"nodejs/report"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SetOutput", func() {
+	var (
+		err             error
+		buildDir        string
+		depsDir         string
+		depDir          string
+		oldVcapServices string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+		depsDir, err = ioutil.TempDir("", "nodejs-buildpack.deps.")
+		Expect(err).To(BeNil())
+		depDir = filepath.Join(depsDir, "07")
+		Expect(os.MkdirAll(depDir, 0755)).To(Succeed())
+
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{}`), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, "buildpack.yml"), []byte("nodejs:\n  hooks:\n    appdynamics: false\n    dynatrace: false\n    seeker: false\n    snyk: false\n"), 0644)).To(Succeed())
+
+		oldVcapServices = os.Getenv("VCAP_SERVICES")
+		os.Setenv("VCAP_SERVICES", `{"newrelic": [{"name":"nr","credentials":{"licenseKey":"key1"}}]}`)
+	})
+
+	AfterEach(func() {
+		hooks.SetOutput(os.Stdout)
+		os.Setenv("VCAP_SERVICES", oldVcapServices)
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(depsDir)).To(Succeed())
+	})
+
+	It("records the hooks' warnings in the staging report", func() {
+		rep := report.New()
+		buffer := new(bytes.Buffer)
+		hooks.SetOutput(rep.Writer(buffer))
+
+		logger := libbuildpack.NewLogger(buffer)
+		stager := libbuildpack.NewStager([]string{buildDir, "", depsDir, "07"}, logger, &libbuildpack.Manifest{})
+		Expect(libbuildpack.RunAfterCompile(stager)).To(Succeed())
+		Expect(rep.Save(depDir)).To(Succeed())
+
+		saved, err := report.Load(depDir)
+		Expect(err).To(BeNil())
+		Expect(saved.Hooks).To(Equal([]string{"newrelic"}))
+		Expect(saved.Warnings).To(ContainElement(ContainSubstring("A New Relic service is bound, but newrelic is not in the dependencies")))
+		Expect(saved.Steps[0].Name).To(Equal("Setting up New Relic agent for service nr"))
+	})
+})
@@ -2,7 +2,6 @@ package hooks
 
 import (
 	"bufio"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +10,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"nodejs/config"
+	"nodejs/report"
 	"os"
 	"path"
 	"path/filepath"
@@ -37,13 +38,19 @@ type SeekerCredentials struct {
 }
 
 func init() {
-	logger := libbuildpack.NewLogger(os.Stdout)
+	logger := libbuildpack.NewLogger(output)
 	command := &libbuildpack.Command{}
 	libbuildpack.AddHook(&SeekerAfterCompileHook{Log: logger, Command: command})
 }
 
 func (h SeekerAfterCompileHook) AfterCompile(compiler *libbuildpack.Stager) error {
 	h.Log.Debug("Seeker - AfterCompileHook Start")
+	if enabled, err := config.HookEnabled(compiler.BuildDir(), "seeker"); err != nil {
+		return err
+	} else if !enabled {
+		h.Log.Debug("Seeker hook disabled in buildpack.yml")
+		return nil
+	}
 	vcapServicesString := os.Getenv("VCAP_SERVICES")
 	h.Log.Debug(vcapServicesString)
 	entryPointPath := os.Getenv(EntryPointFile)
@@ -77,6 +84,9 @@ func (h SeekerAfterCompileHook) AfterCompile(compiler *libbuildpack.Stager) erro
 	h.serviceCredentials = &serviceCredentials
 	credentialsJSON, _ := json.Marshal(h.serviceCredentials)
 	h.Log.Info("Credentials extraction ok: %s", credentialsJSON)
+	if err := report.AddHook(compiler.DepDir(), "seeker"); err != nil {
+		return err
+	}
 
 	err, useSensorDownload := h.shouldDownloadSensor()
 	seekerLibraryToInstall := ""
@@ -118,12 +128,7 @@ func (h SeekerAfterCompileHook) shouldDownloadSensor() (error, bool) {
 	}
 	parsedEnterpriseServerUrl.Path = path.Join(parsedEnterpriseServerUrl.Path, "/rest/api/version")
 	versionApiAbsoluteUrl := parsedEnterpriseServerUrl.String()
-	if strings.HasPrefix(versionApiAbsoluteUrl, "https") {
-		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		response, err = http.Get(versionApiAbsoluteUrl)
-	} else {
-		response, err = http.Get(versionApiAbsoluteUrl)
-	}
+	response, err = http.Get(versionApiAbsoluteUrl)
 	if err != nil {
 		h.Log.Error("The HTTP request to: `%s` failed with error %s\n", err, versionApiAbsoluteUrl)
 	} else {
@@ -175,12 +180,7 @@ func assertServiceCredentialsValid(credentials SeekerCredentials) error {
 func (h SeekerAfterCompileHook) downloadFile(url, destFile string) error {
 	var err error
 	var resp *http.Response
-	if strings.HasPrefix(url, "https") {
-		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-		resp, err = http.Get(url)
-	} else {
-		resp, err = http.Get(url)
-	}
+	resp, err = http.Get(url)
 	if err != nil {
 		return err
 	}
@@ -3,7 +3,6 @@ package hooks_test
 import (
 	"bytes"
 	"github.com/cloudfoundry/libbuildpack"
-	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"gopkg.in/jarcoal/httpmock.v1"
@@ -15,16 +14,14 @@ import (
 
 var _ = Describe("seekerHook", func() {
 	var (
-		err         error
-		buildDir    string
-		depsDir     string
-		depsIdx     string
-		logger      *libbuildpack.Logger
-		stager      *libbuildpack.Stager
-		mockCtrl    *gomock.Controller
-		mockCommand *MockCommand
-		buffer      *bytes.Buffer
-		seeker      hooks.SeekerAfterCompileHook
+		err      error
+		buildDir string
+		depsDir  string
+		depsIdx  string
+		logger   *libbuildpack.Logger
+		stager   *libbuildpack.Stager
+		buffer   *bytes.Buffer
+		seeker   hooks.SeekerAfterCompileHook
 	)
 
 	BeforeEach(func() {
@@ -40,7 +37,6 @@ var _ = Describe("seekerHook", func() {
 		buffer = new(bytes.Buffer)
 		logger = libbuildpack.NewLogger(buffer)
 
-		mockCommand = NewMockCommand(mockCtrl)
 		logger := libbuildpack.NewLogger(os.Stdout)
 		command := &libbuildpack.Command{}
 
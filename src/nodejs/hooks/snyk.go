@@ -2,6 +2,8 @@ package hooks
 
 import (
 	"encoding/json"
+	"nodejs/config"
+	"nodejs/report"
 	"os"
 	"path/filepath"
 	"strings"
@@ -33,7 +35,7 @@ type SnykCredentials struct {
 const snykLocalAgentPath = "node_modules/snyk/cli/index.js"
 
 func init() {
-	logger := libbuildpack.NewLogger(os.Stdout)
+	logger := libbuildpack.NewLogger(output)
 	command := &libbuildpack.Command{}
 
 	libbuildpack.AddHook(SnykHook{
@@ -48,11 +50,21 @@ func init() {
 
 //Snyk hook
 func (h SnykHook) AfterCompile(stager *libbuildpack.Stager) error {
+	if enabled, err := config.HookEnabled(stager.BuildDir(), "snyk"); err != nil {
+		return err
+	} else if !enabled {
+		h.Log.Debug("Snyk hook disabled in buildpack.yml")
+		return nil
+	}
+
 	if h.isTokenExists() == false {
 		h.Log.Debug("Snyk token wasn't found...")
 		return nil
 	}
 	h.Log.Debug("Snyk token was found.")
+	if err := report.AddHook(stager.DepDir(), "snyk"); err != nil {
+		return err
+	}
 	h.Log.BeginStep("Checking if Snyk service is enabled...")
 
 	dontBreakBuild := strings.ToLower(os.Getenv("SNYK_DONT_BREAK_BUILD")) == "true"
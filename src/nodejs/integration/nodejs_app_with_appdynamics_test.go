@@ -69,7 +69,7 @@ var _ = Describe("CF NodeJS Buildpack", func() {
 			Expect(RunCf("create-user-provided-service", "app-dynamics", "-p", `{"host-name":"test-ups-2-host","port":"1234","account-name":"test-account","ssl-enabled":"true","account-access-key":"test-key"}`)).To(Succeed())
 			Expect(RunCf("bind-service", app.Name, "app-dynamics")).To(Succeed())
 
-			Expect(RunCf("restart", app.Name)).To(Succeed())
+			Expect(RunCf("restage", app.Name)).To(Succeed())
 			Eventually(func() ([]string, error) { return app.InstanceStates() }, 20*time.Second).Should(Equal([]string{"RUNNING"}))
 
 			Expect(app.GetBody("/")).To(ContainSubstring("Hello, World!"))
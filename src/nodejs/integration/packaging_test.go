@@ -0,0 +1,31 @@
+package integration_test
+
+import (
+	"archive/zip"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("packaged buildpack", func() {
+	BeforeEach(func() {
+		if packagedBuildpack.File == "" {
+			Skip("Only checked when the tests package the buildpack")
+		}
+	})
+
+	It("ships the launch helper", func() {
+		r, err := zip.OpenReader(packagedBuildpack.File)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		var helper *zip.File
+		for _, f := range r.File {
+			if f.Name == "bin/launch-env" {
+				helper = f
+			}
+		}
+		Expect(helper).NotTo(BeNil(), "bin/launch-env is missing from %s", packagedBuildpack.File)
+		Expect(helper.Mode() & 0111).NotTo(BeZero())
+	})
+})
@@ -0,0 +1,227 @@
+package inventory
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Package is one installed dependency.
+type Package struct {
+	Name      string
+	Version   string
+	License   string
+	Integrity string
+	// Path is the package directory, empty for packages only known from a
+	// lockfile.
+	Path string
+	// Dependencies names the packages this one requires at runtime.
+	Dependencies []string
+}
+
+// ID returns name@version, which identifies a package across trees.
+func (p Package) ID() string {
+	return p.Name + "@" + p.Version
+}
+
+type manifest struct {
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	License   json.RawMessage `json:"license"`
+	Licenses  json.RawMessage `json:"licenses"`
+	Integrity string          `json:"_integrity"`
+
+	Dependencies         map[string]string `json:"dependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// NodeModulesDirs lists where staging leaves node_modules: moved into the dep
+// dir, or still in the app when vendored or added by a hook.
+func NodeModulesDirs(buildDir, depDir, workspace string) []string {
+	return []string{
+		filepath.Join(depDir, "workspace", "node_modules"),
+		filepath.Join(depDir, "node_modules"),
+		filepath.Join(buildDir, workspace, "node_modules"),
+		filepath.Join(buildDir, "node_modules"),
+	}
+}
+
+// Installed lists the packages in the given node_modules directories, which
+// need not exist. Nested node_modules and pnpm's .pnpm store are included,
+// symlinks are not followed. A package installed more than once at the same
+// version is listed once.
+func Installed(nodeModulesDirs ...string) ([]Package, error) {
+	found := map[string]Package{}
+	for _, dir := range nodeModulesDirs {
+		if err := scanNodeModules(dir, found); err != nil {
+			return nil, err
+		}
+	}
+	return sorted(found), nil
+}
+
+// Inventory lists the app's dependencies. Packages come from the given
+// node_modules directories; when none are installed, as for Yarn
+// Plug'n'Play apps, they come from the lockfile in buildDir instead.
+// Integrity hashes missing from package.json are filled in from the
+// lockfile.
+func Inventory(buildDir string, nodeModulesDirs ...string) ([]Package, error) {
+	packages, err := Installed(nodeModulesDirs...)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := Locked(buildDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(packages) == 0 {
+		return locked, nil
+	}
+
+	integrity := map[string]string{}
+	for _, pkg := range locked {
+		integrity[pkg.ID()] = pkg.Integrity
+	}
+	for i, pkg := range packages {
+		if pkg.Integrity == "" {
+			packages[i].Integrity = integrity[pkg.ID()]
+		}
+	}
+	return packages, nil
+}
+
+func scanNodeModules(dir string, found map[string]Package) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() {
+			continue
+		}
+
+		switch {
+		case entry.Name() == ".pnpm":
+			stores, err := ioutil.ReadDir(path)
+			if err != nil {
+				return err
+			}
+			for _, store := range stores {
+				if err := scanNodeModules(filepath.Join(path, store.Name(), "node_modules"), found); err != nil {
+					return err
+				}
+			}
+		case strings.HasPrefix(entry.Name(), "."):
+		case strings.HasPrefix(entry.Name(), "@"):
+			scoped, err := ioutil.ReadDir(path)
+			if err != nil {
+				return err
+			}
+			for _, pkg := range scoped {
+				if pkg.IsDir() {
+					if err := scanPackage(filepath.Join(path, pkg.Name()), found); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			if err := scanPackage(path, found); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func scanPackage(dir string, found map[string]Package) error {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(contents, &m); err == nil && m.Name != "" {
+		pkg := Package{
+			Name:         m.Name,
+			Version:      m.Version,
+			License:      license(m),
+			Integrity:    m.Integrity,
+			Path:         dir,
+			Dependencies: names(m.Dependencies, m.OptionalDependencies),
+		}
+		if _, seen := found[pkg.ID()]; !seen {
+			found[pkg.ID()] = pkg
+		}
+	}
+
+	return scanNodeModules(filepath.Join(dir, "node_modules"), found)
+}
+
+// license reads the SPDX expression in "license", or joins the deprecated
+// "licenses" list, and the older {"type": ...} objects used in both, with OR.
+func license(m manifest) string {
+	var expression string
+	if err := json.Unmarshal(m.License, &expression); err == nil {
+		return expression
+	}
+
+	var object struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(m.License, &object); err == nil && object.Type != "" {
+		return object.Type
+	}
+
+	var list []struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(m.Licenses, &list); err == nil && len(list) > 0 {
+		types := make([]string, 0, len(list))
+		for _, l := range list {
+			types = append(types, l.Type)
+		}
+		if len(types) == 1 {
+			return types[0]
+		}
+		return "(" + strings.Join(types, " OR ") + ")"
+	}
+
+	return ""
+}
+
+func names(deps ...map[string]string) []string {
+	var result []string
+	for _, m := range deps {
+		for name := range m {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func sorted(found map[string]Package) []Package {
+	packages := make([]Package, 0, len(found))
+	for _, pkg := range found {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Version < packages[j].Version
+	})
+	return packages
+}
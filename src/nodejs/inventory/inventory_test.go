@@ -0,0 +1,124 @@
+package inventory_test
+
+import (
+	"io/ioutil"
+	"nodejs/inventory"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Inventory", func() {
+	var (
+		err      error
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	writeFile := func(name, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(buildDir, name)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	ids := func(packages []inventory.Package) []string {
+		var result []string
+		for _, pkg := range packages {
+			result = append(result, pkg.ID())
+		}
+		return result
+	}
+
+	Describe("Installed", func() {
+		It("lists nested, scoped and pnpm store packages once", func() {
+			writeFile("node_modules/express/package.json", `{"name": "express", "version": "4.16.3", "license": "MIT", "_integrity": "sha512-abc", "dependencies": {"debug": "2.6.9"}, "optionalDependencies": {"fsevents": "*"}}`)
+			writeFile("node_modules/express/node_modules/debug/package.json", `{"name": "debug", "version": "2.6.9", "license": {"type": "MIT"}}`)
+			writeFile("node_modules/express/test/fixture/package.json", `{"name": "fixture", "version": "0.0.0"}`)
+			writeFile("node_modules/@babel/core/package.json", `{"name": "@babel/core", "version": "7.0.0", "licenses": [{"type": "MIT"}, {"type": "Apache-2.0"}]}`)
+			writeFile("node_modules/.pnpm/ms@2.0.0/node_modules/ms/package.json", `{"name": "ms", "version": "2.0.0"}`)
+			writeFile("node_modules/.bin/package.json", `{"name": "bin", "version": "1.0.0"}`)
+			writeFile("other/node_modules/debug/package.json", `{"name": "debug", "version": "2.6.9"}`)
+
+			packages, err := inventory.Installed(filepath.Join(buildDir, "node_modules"), filepath.Join(buildDir, "other", "node_modules"), filepath.Join(buildDir, "missing"))
+			Expect(err).To(BeNil())
+			Expect(ids(packages)).To(Equal([]string{"@babel/core@7.0.0", "debug@2.6.9", "express@4.16.3", "ms@2.0.0"}))
+			Expect(packages[0].License).To(Equal("(MIT OR Apache-2.0)"))
+			Expect(packages[1].License).To(Equal("MIT"))
+			Expect(packages[2].Integrity).To(Equal("sha512-abc"))
+			Expect(packages[2].Path).To(Equal(filepath.Join(buildDir, "node_modules", "express")))
+			Expect(packages[2].Dependencies).To(Equal([]string{"debug", "fsevents"}))
+		})
+
+		It("does not follow symlinks", func() {
+			writeFile("packages/api/package.json", `{"name": "api", "version": "1.0.0"}`)
+			Expect(os.MkdirAll(filepath.Join(buildDir, "node_modules"), 0755)).To(Succeed())
+			Expect(os.Symlink("../packages/api", filepath.Join(buildDir, "node_modules", "api"))).To(Succeed())
+
+			packages, err := inventory.Installed(filepath.Join(buildDir, "node_modules"))
+			Expect(err).To(BeNil())
+			Expect(packages).To(BeEmpty())
+		})
+	})
+
+	Describe("Locked", func() {
+		It("reads a lockfileVersion 1 package-lock.json", func() {
+			writeFile("package-lock.json", `{"lockfileVersion": 1, "dependencies": {"express": {"version": "4.16.3", "integrity": "sha512-abc", "dependencies": {"debug": {"version": "2.6.9"}}}}}`)
+			packages, err := inventory.Locked(buildDir)
+			Expect(err).To(BeNil())
+			Expect(ids(packages)).To(Equal([]string{"debug@2.6.9", "express@4.16.3"}))
+			Expect(packages[1].Integrity).To(Equal("sha512-abc"))
+		})
+
+		It("reads a lockfileVersion 2 package-lock.json", func() {
+			writeFile("package-lock.json", `{"lockfileVersion": 2, "packages": {"": {"name": "app"}, "node_modules/@babel/core": {"version": "7.0.0"}, "node_modules/express/node_modules/debug": {"version": "2.6.9"}, "node_modules/api": {"resolved": "packages/api", "link": true}}}`)
+			packages, err := inventory.Locked(buildDir)
+			Expect(err).To(BeNil())
+			Expect(ids(packages)).To(Equal([]string{"@babel/core@7.0.0", "debug@2.6.9"}))
+		})
+
+		It("reads yarn.lock", func() {
+			writeFile("yarn.lock", "# yarn lockfile v1\n\n\"@babel/core@^7.0.0\", \"@babel/core@^7.0.1\":\n  version \"7.0.1\"\n  resolved \"https://registry.yarnpkg.com/@babel/core/-/core-7.0.1.tgz\"\n  integrity sha512-xyz\n\nms@2.0.0:\n  version \"2.0.0\"\n")
+			packages, err := inventory.Locked(buildDir)
+			Expect(err).To(BeNil())
+			Expect(ids(packages)).To(Equal([]string{"@babel/core@7.0.1", "ms@2.0.0"}))
+			Expect(packages[0].Integrity).To(Equal("sha512-xyz"))
+		})
+
+		It("reads pnpm-lock.yaml", func() {
+			writeFile("pnpm-lock.yaml", "lockfileVersion: 5.4\npackages:\n  /ms/2.0.0:\n    resolution: {integrity: sha512-ms}\n  /@babel/core/7.0.0_supports-color@5.5.0:\n    resolution: {integrity: sha512-babel}\n  /left_pad@1.3.0(react@18.0.0):\n    resolution: {integrity: sha512-lp}\n")
+			packages, err := inventory.Locked(buildDir)
+			Expect(err).To(BeNil())
+			Expect(ids(packages)).To(Equal([]string{"@babel/core@7.0.0", "left_pad@1.3.0", "ms@2.0.0"}))
+			Expect(packages[2].Integrity).To(Equal("sha512-ms"))
+		})
+	})
+
+	Describe("Inventory", func() {
+		BeforeEach(func() {
+			writeFile("package-lock.json", `{"lockfileVersion": 1, "dependencies": {"express": {"version": "4.16.3", "integrity": "sha512-abc"}}}`)
+		})
+
+		It("fills in integrity hashes from the lockfile", func() {
+			writeFile("node_modules/express/package.json", `{"name": "express", "version": "4.16.3"}`)
+			packages, err := inventory.Inventory(buildDir, filepath.Join(buildDir, "node_modules"))
+			Expect(err).To(BeNil())
+			Expect(packages).To(HaveLen(1))
+			Expect(packages[0].Integrity).To(Equal("sha512-abc"))
+		})
+
+		It("falls back to the lockfile when nothing is installed", func() {
+			packages, err := inventory.Inventory(buildDir, filepath.Join(buildDir, "node_modules"))
+			Expect(err).To(BeNil())
+			Expect(ids(packages)).To(Equal([]string{"express@4.16.3"}))
+		})
+	})
+})
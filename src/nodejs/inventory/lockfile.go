@@ -0,0 +1,202 @@
+package inventory
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Locked lists the packages pinned by the app's lockfile: npm-shrinkwrap.json
+// or package-lock.json, yarn.lock or pnpm-lock.yaml, whichever is found
+// first. Packages from a lockfile carry no license.
+func Locked(buildDir string) ([]Package, error) {
+	found := map[string]Package{}
+
+	for _, reader := range []struct {
+		filename string
+		read     func(string, map[string]Package) error
+	}{
+		{"npm-shrinkwrap.json", readPackageLock},
+		{"package-lock.json", readPackageLock},
+		{"yarn.lock", readYarnLock},
+		{"pnpm-lock.yaml", readPNPMLock},
+	} {
+		path := filepath.Join(buildDir, reader.filename)
+		if exists, err := libbuildpack.FileExists(path); err != nil {
+			return nil, err
+		} else if exists {
+			if err := reader.read(path, found); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return sorted(found), nil
+}
+
+type lockedDependency struct {
+	Version      string                      `json:"version"`
+	Integrity    string                      `json:"integrity"`
+	Dependencies map[string]lockedDependency `json:"dependencies"`
+}
+
+func readPackageLock(path string, found map[string]Package) error {
+	var lock struct {
+		Packages map[string]struct {
+			Name      string `json:"name"`
+			Version   string `json:"version"`
+			Integrity string `json:"integrity"`
+			Link      bool   `json:"link"`
+		} `json:"packages"`
+		Dependencies map[string]lockedDependency `json:"dependencies"`
+	}
+	if err := libbuildpack.NewJSON().Load(path, &lock); err != nil {
+		return err
+	}
+
+	// lockfileVersion 2 and later key packages by their install path.
+	if len(lock.Packages) > 0 {
+		for key, entry := range lock.Packages {
+			idx := strings.LastIndex(key, "node_modules/")
+			if idx < 0 || entry.Link {
+				continue
+			}
+			name := entry.Name
+			if name == "" {
+				name = key[idx+len("node_modules/"):]
+			}
+			add(found, Package{Name: name, Version: entry.Version, Integrity: entry.Integrity})
+		}
+		return nil
+	}
+
+	var walk func(map[string]lockedDependency)
+	walk = func(deps map[string]lockedDependency) {
+		for name, dep := range deps {
+			add(found, Package{Name: name, Version: dep.Version, Integrity: dep.Integrity})
+			walk(dep.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return nil
+}
+
+// readYarnLock reads the yarn 1 lockfile format, a header line naming the
+// package, followed by indented version and integrity fields.
+func readYarnLock(path string, found map[string]Package) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var current Package
+	flush := func() {
+		if current.Name != "" && current.Version != "" {
+			add(found, current)
+		}
+		current = Package{}
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") {
+			flush()
+			current.Name = yarnLockName(line)
+			continue
+		}
+
+		field := strings.Fields(strings.TrimSpace(line))
+		if len(field) != 2 {
+			continue
+		}
+		value := strings.Trim(field[1], `"`)
+		switch strings.TrimSuffix(field[0], ":") {
+		case "version":
+			current.Version = value
+		case "integrity", "checksum":
+			current.Integrity = value
+		}
+	}
+	flush()
+
+	return scanner.Err()
+}
+
+// yarnLockName takes the name from a header like `"@babel/core@^7.0.0", "@babel/core@^7.1.0":`.
+func yarnLockName(header string) string {
+	spec := strings.TrimSpace(strings.Split(strings.TrimSuffix(header, ":"), ",")[0])
+	spec = strings.Trim(spec, `"`)
+	if idx := strings.LastIndex(spec, "@"); idx > 0 {
+		return spec[:idx]
+	}
+	return ""
+}
+
+func readPNPMLock(path string, found map[string]Package) error {
+	var lock struct {
+		Packages map[string]struct {
+			Name       string `yaml:"name"`
+			Version    string `yaml:"version"`
+			Resolution struct {
+				Integrity string `yaml:"integrity"`
+			} `yaml:"resolution"`
+		} `yaml:"packages"`
+	}
+	if err := libbuildpack.NewYAML().Load(path, &lock); err != nil {
+		return err
+	}
+
+	for key, entry := range lock.Packages {
+		name, version := pnpmLockKey(key)
+		if entry.Name != "" {
+			name, version = entry.Name, entry.Version
+		}
+		if name == "" {
+			continue
+		}
+		add(found, Package{Name: name, Version: version, Integrity: entry.Resolution.Integrity})
+	}
+	return nil
+}
+
+// pnpmLockKey splits the package keys pnpm has used over time:
+// "/name/1.0.0", "/name@1.0.0" and "name@1.0.0", any of them scoped and
+// followed by a peer dependency suffix.
+func pnpmLockKey(key string) (string, string) {
+	key = strings.TrimPrefix(key, "/")
+
+	var scope string
+	if strings.HasPrefix(key, "@") {
+		idx := strings.Index(key, "/")
+		if idx < 0 {
+			return "", ""
+		}
+		scope, key = key[:idx+1], key[idx+1:]
+	}
+
+	idx := strings.IndexAny(key, "@/")
+	if idx <= 0 {
+		return "", ""
+	}
+	version := key[idx+1:]
+	if end := strings.IndexAny(version, "_("); end > 0 {
+		version = version[:end]
+	}
+	return scope + key[:idx], version
+}
+
+func add(found map[string]Package, pkg Package) {
+	if _, seen := found[pkg.ID()]; !seen {
+		found[pkg.ID()] = pkg
+	}
+}
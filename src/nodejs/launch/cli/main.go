@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"nodejs/launch"
+	"os"
+	"path/filepath"
+)
+
+// main prints the export statements profile.d/node.sh evaluates before the
+// app starts. It never fails, so a broken calculation or malformed
+// VCAP_SERVICES cannot stop the app.
+func main() {
+	settings := launch.Calculate(launch.ReadLimits(launch.CgroupRoot), os.LookupEnv)
+
+	for _, warning := range settings.Warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	if os.Getenv("LOG_CONCURRENCY") == "true" {
+		fmt.Fprintf(os.Stderr, "Detected %d MB available memory, %d MB limit per process (WEB_MEMORY)\n", settings.MemoryAvailable, settings.WebMemory)
+		fmt.Fprintf(os.Stderr, "Recommending WEB_CONCURRENCY=%d\n", settings.WebConcurrency)
+	}
+
+	vars := settings.Vars()
+	if executable, err := os.Executable(); err == nil {
+		bound, err := launch.ReadServices(filepath.Dir(executable))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read %s: %s\n", launch.ServicesFile, err)
+		}
+		services, warnings := launch.Services(bound, os.LookupEnv)
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, warning)
+		}
+		vars = append(vars, services...)
+	}
+
+	fmt.Print(launch.Exports(vars))
+}
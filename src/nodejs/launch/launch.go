@@ -0,0 +1,205 @@
+package launch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Helper is the name of the helper binary in the dep dir. profile.d/node.sh
+// evaluates its output when the app starts.
+const Helper = "launch-env"
+
+// CgroupRoot is where the container's cgroup hierarchy is mounted.
+const CgroupRoot = "/sys/fs/cgroup"
+
+const (
+	defaultWebMemory = 512
+	// heapPercent of each process's share of memory goes to V8's old
+	// space, leaving the rest for the stack, buffers and native memory.
+	heapPercent = 75
+	// cgroup v1 reports no limit as a page-aligned max int64.
+	unlimited = int64(1) << 60
+)
+
+var heapFlag = regexp.MustCompile(`--max[-_]old[-_]space[-_]size`)
+
+// Limits are the container's resource limits. Zero means unlimited or
+// unknown.
+type Limits struct {
+	// Memory is in bytes.
+	Memory int64
+	CPUs   float64
+}
+
+// ReadLimits reads the memory limit and CPU quota from the cgroup v2
+// hierarchy at root, or from the v1 memory and cpu controllers below it.
+func ReadLimits(root string) Limits {
+	var limits Limits
+
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		limits.Memory = readInt(filepath.Join(root, "memory.max"))
+		if cpuMax, err := readFields(filepath.Join(root, "cpu.max")); err == nil && len(cpuMax) == 2 {
+			limits.CPUs = quota(parseInt(cpuMax[0]), parseInt(cpuMax[1]))
+		}
+		return limits
+	}
+
+	limits.Memory = readInt(filepath.Join(root, "memory", "memory.limit_in_bytes"))
+	limits.CPUs = quota(readInt(filepath.Join(root, "cpu", "cpu.cfs_quota_us")), readInt(filepath.Join(root, "cpu", "cpu.cfs_period_us")))
+	return limits
+}
+
+// Var is an environment variable to export.
+type Var struct {
+	Name  string
+	Value string
+}
+
+// Settings are what the app's processes should be started with.
+type Settings struct {
+	// MemoryAvailable is in MB, and zero when no limit was found.
+	MemoryAvailable int64
+	WebMemory       int64
+	WebConcurrency  int64
+	NodeOptions     string
+	// Warnings explain settings that were ignored.
+	Warnings []string
+}
+
+// Calculate derives the settings from limits and the environment. Values
+// the user set in the environment are kept: MEMORY_AVAILABLE replaces the
+// detected memory, WEB_CONCURRENCY is not recalculated, and NODE_OPTIONS
+// only gains a heap size when it has none and OPTIMIZE_MEMORY is true.
+func Calculate(limits Limits, lookup func(string) (string, bool)) Settings {
+	var s Settings
+
+	number := func(name string) int64 {
+		value, found := lookup(name)
+		if !found || value == "" {
+			return 0
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || n < 1 {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("Ignoring %s=%s, it must be a positive whole number", name, value))
+			return 0
+		}
+		return n
+	}
+
+	if s.MemoryAvailable = number("MEMORY_AVAILABLE"); s.MemoryAvailable == 0 && limits.Memory > 0 {
+		s.MemoryAvailable = limits.Memory / (1024 * 1024)
+	}
+	if s.MemoryAvailable == 0 {
+		s.MemoryAvailable = vcapMemory(lookup)
+	}
+
+	if s.WebMemory = number("WEB_MEMORY"); s.WebMemory == 0 {
+		s.WebMemory = defaultWebMemory
+	}
+
+	if s.WebConcurrency = number("WEB_CONCURRENCY"); s.WebConcurrency == 0 {
+		s.WebConcurrency = s.MemoryAvailable / s.WebMemory
+		if limits.CPUs > 0 {
+			if cpus := int64(math.Ceil(limits.CPUs)); cpus < s.WebConcurrency {
+				s.WebConcurrency = cpus
+			}
+		}
+		if s.WebConcurrency < 1 {
+			s.WebConcurrency = 1
+		}
+	}
+
+	s.NodeOptions, _ = lookup("NODE_OPTIONS")
+	optimize, _ := lookup("OPTIMIZE_MEMORY")
+	if s.MemoryAvailable > 0 && optimize == "true" && !heapFlag.MatchString(s.NodeOptions) {
+		heap := s.MemoryAvailable / s.WebConcurrency * heapPercent / 100
+		s.NodeOptions = strings.TrimSpace(fmt.Sprintf("%s --max_old_space_size=%d", s.NodeOptions, heap))
+	}
+
+	return s
+}
+
+// Vars are the settings to export.
+func (s Settings) Vars() []Var {
+	var vars []Var
+	if s.MemoryAvailable > 0 {
+		vars = append(vars, Var{"MEMORY_AVAILABLE", strconv.FormatInt(s.MemoryAvailable, 10)})
+	}
+	vars = append(vars,
+		Var{"WEB_MEMORY", strconv.FormatInt(s.WebMemory, 10)},
+		Var{"WEB_CONCURRENCY", strconv.FormatInt(s.WebConcurrency, 10)},
+	)
+	if s.NodeOptions != "" {
+		vars = append(vars, Var{"NODE_OPTIONS", s.NodeOptions})
+	}
+	return vars
+}
+
+// Exports renders vars as shell export statements.
+func Exports(vars []Var) string {
+	var exports string
+	for _, v := range vars {
+		exports += fmt.Sprintf("export %s=%s\n", v.Name, Quote(v.Value))
+	}
+	return exports
+}
+
+// vcapMemory returns limits.mem from VCAP_APPLICATION, for containers whose
+// cgroup limit cannot be read.
+func vcapMemory(lookup func(string) (string, bool)) int64 {
+	var app struct {
+		Limits struct {
+			Mem int64 `json:"mem"`
+		} `json:"limits"`
+	}
+	value, _ := lookup("VCAP_APPLICATION")
+	if json.Unmarshal([]byte(value), &app) != nil {
+		return 0
+	}
+	return app.Limits.Mem
+}
+
+// Quote single-quotes value for a POSIX shell.
+func Quote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+func quota(quota, period int64) float64 {
+	if quota <= 0 || period <= 0 {
+		return 0
+	}
+	return float64(quota) / float64(period)
+}
+
+func readFields(path string) ([]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(contents)), nil
+}
+
+// readInt returns the number in the file at path, or 0 when it is missing,
+// "max" or unlimited.
+func readInt(path string) int64 {
+	fields, err := readFields(path)
+	if err != nil || len(fields) != 1 {
+		return 0
+	}
+	return parseInt(fields[0])
+}
+
+func parseInt(value string) int64 {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n >= unlimited {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,171 @@
+package launch_test
+
+import (
+	"io/ioutil"
+	"nodejs/launch"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Launch", func() {
+	var (
+		err  error
+		root string
+	)
+
+	BeforeEach(func() {
+		root, err = ioutil.TempDir("", "nodejs-buildpack.cgroup.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(root)).To(Succeed())
+	})
+
+	writeFile := func(path, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(root, path), []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("ReadLimits", func() {
+		It("reads cgroup v2 limits", func() {
+			writeFile("cgroup.controllers", "cpu memory pids\n")
+			writeFile("memory.max", "1073741824\n")
+			writeFile("cpu.max", "150000 100000\n")
+			Expect(launch.ReadLimits(root)).To(Equal(launch.Limits{Memory: 1073741824, CPUs: 1.5}))
+		})
+
+		It("treats max as unlimited in cgroup v2", func() {
+			writeFile("cgroup.controllers", "cpu memory pids\n")
+			writeFile("memory.max", "max\n")
+			writeFile("cpu.max", "max 100000\n")
+			Expect(launch.ReadLimits(root)).To(Equal(launch.Limits{}))
+		})
+
+		It("reads cgroup v1 limits", func() {
+			writeFile("memory/memory.limit_in_bytes", "536870912\n")
+			writeFile("cpu/cpu.cfs_quota_us", "200000\n")
+			writeFile("cpu/cpu.cfs_period_us", "100000\n")
+			Expect(launch.ReadLimits(root)).To(Equal(launch.Limits{Memory: 536870912, CPUs: 2}))
+		})
+
+		It("treats the v1 sentinels as unlimited", func() {
+			writeFile("memory/memory.limit_in_bytes", "9223372036854771712\n")
+			writeFile("cpu/cpu.cfs_quota_us", "-1\n")
+			writeFile("cpu/cpu.cfs_period_us", "100000\n")
+			Expect(launch.ReadLimits(root)).To(Equal(launch.Limits{}))
+		})
+
+		It("returns no limits without cgroups", func() {
+			Expect(launch.ReadLimits(root)).To(Equal(launch.Limits{}))
+		})
+	})
+
+	Describe("Calculate", func() {
+		var env map[string]string
+
+		lookup := func(name string) (string, bool) {
+			value, found := env[name]
+			return value, found
+		}
+
+		BeforeEach(func() {
+			env = map[string]string{"OPTIMIZE_MEMORY": "true"}
+		})
+
+		It("sizes concurrency and the heap from the memory limit", func() {
+			settings := launch.Calculate(launch.Limits{Memory: 2048 * 1024 * 1024}, lookup)
+			Expect(settings.MemoryAvailable).To(Equal(int64(2048)))
+			Expect(settings.WebMemory).To(Equal(int64(512)))
+			Expect(settings.WebConcurrency).To(Equal(int64(4)))
+			Expect(settings.NodeOptions).To(Equal("--max_old_space_size=384"))
+		})
+
+		It("runs no more processes than the CPU quota allows", func() {
+			settings := launch.Calculate(launch.Limits{Memory: 2048 * 1024 * 1024, CPUs: 1.5}, lookup)
+			Expect(settings.WebConcurrency).To(Equal(int64(2)))
+			Expect(settings.NodeOptions).To(Equal("--max_old_space_size=768"))
+		})
+
+		It("runs one process when memory is below WEB_MEMORY", func() {
+			settings := launch.Calculate(launch.Limits{Memory: 128 * 1024 * 1024}, lookup)
+			Expect(settings.WebConcurrency).To(Equal(int64(1)))
+			Expect(settings.NodeOptions).To(Equal("--max_old_space_size=96"))
+		})
+
+		It("falls back to the memory limit in VCAP_APPLICATION", func() {
+			env["VCAP_APPLICATION"] = `{"limits": {"mem": 1024, "disk": 1024}}`
+			settings := launch.Calculate(launch.Limits{}, lookup)
+			Expect(settings.MemoryAvailable).To(Equal(int64(1024)))
+			Expect(settings.WebConcurrency).To(Equal(int64(2)))
+		})
+
+		It("leaves the heap alone when no limit is known", func() {
+			settings := launch.Calculate(launch.Limits{}, lookup)
+			Expect(settings.MemoryAvailable).To(BeZero())
+			Expect(settings.WebConcurrency).To(Equal(int64(1)))
+			Expect(settings.NodeOptions).To(Equal(""))
+		})
+
+		It("keeps the values the user set", func() {
+			env["MEMORY_AVAILABLE"] = "1024"
+			env["WEB_MEMORY"] = "256"
+			env["WEB_CONCURRENCY"] = "2"
+			settings := launch.Calculate(launch.Limits{Memory: 4096 * 1024 * 1024}, lookup)
+			Expect(settings.MemoryAvailable).To(Equal(int64(1024)))
+			Expect(settings.WebMemory).To(Equal(int64(256)))
+			Expect(settings.WebConcurrency).To(Equal(int64(2)))
+			Expect(settings.NodeOptions).To(Equal("--max_old_space_size=384"))
+		})
+
+		It("adds the heap size to the user's NODE_OPTIONS", func() {
+			env["NODE_OPTIONS"] = "--enable-source-maps"
+			settings := launch.Calculate(launch.Limits{Memory: 512 * 1024 * 1024}, lookup)
+			Expect(settings.NodeOptions).To(Equal("--enable-source-maps --max_old_space_size=384"))
+		})
+
+		It("does not override a heap size the user set", func() {
+			env["NODE_OPTIONS"] = "--max-old-space-size=200"
+			settings := launch.Calculate(launch.Limits{Memory: 512 * 1024 * 1024}, lookup)
+			Expect(settings.NodeOptions).To(Equal("--max-old-space-size=200"))
+		})
+
+		It("does not set the heap size when OPTIMIZE_MEMORY is false", func() {
+			env["OPTIMIZE_MEMORY"] = "false"
+			settings := launch.Calculate(launch.Limits{Memory: 512 * 1024 * 1024}, lookup)
+			Expect(settings.NodeOptions).To(Equal(""))
+		})
+
+		It("does not set the heap size when OPTIMIZE_MEMORY is unset", func() {
+			delete(env, "OPTIMIZE_MEMORY")
+			settings := launch.Calculate(launch.Limits{Memory: 512 * 1024 * 1024}, lookup)
+			Expect(settings.NodeOptions).To(Equal(""))
+			Expect(settings.WebConcurrency).To(Equal(int64(1)))
+		})
+
+		It("warns about and ignores invalid numbers", func() {
+			env["WEB_CONCURRENCY"] = "lots"
+			settings := launch.Calculate(launch.Limits{Memory: 1024 * 1024 * 1024}, lookup)
+			Expect(settings.WebConcurrency).To(Equal(int64(2)))
+			Expect(settings.Warnings).To(ConsistOf("Ignoring WEB_CONCURRENCY=lots, it must be a positive whole number"))
+		})
+	})
+
+	Describe("Exports", func() {
+		It("quotes the values for the shell", func() {
+			settings := launch.Settings{MemoryAvailable: 1024, WebMemory: 512, WebConcurrency: 2, NodeOptions: "--title='my app' --max_old_space_size=384"}
+			Expect(launch.Exports(settings.Vars())).To(Equal("export MEMORY_AVAILABLE='1024'\n" +
+				"export WEB_MEMORY='512'\n" +
+				"export WEB_CONCURRENCY='2'\n" +
+				"export NODE_OPTIONS='--title='\\''my app'\\'' --max_old_space_size=384'\n"))
+		})
+
+		It("leaves out unknown memory and empty NODE_OPTIONS", func() {
+			settings := launch.Settings{WebMemory: 512, WebConcurrency: 1}
+			Expect(launch.Exports(settings.Vars())).To(Equal("export WEB_MEMORY='512'\nexport WEB_CONCURRENCY='1'\n"))
+		})
+	})
+})
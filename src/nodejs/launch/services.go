@@ -0,0 +1,142 @@
+package launch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// ServicesFile lists, in the dep dir, the bound service each agent hook
+// set up while staging. The helper exports those services' credentials as
+// they are when the app starts, so a rotated key or a service rebound under
+// the same name only needs a restart, not a restage.
+const ServicesFile = "agent_services.json"
+
+type credential struct {
+	name string
+	keys []string
+	// boolean values are exported as true or false.
+	boolean bool
+}
+
+// agentCredentials are the variables each agent reads its connection and
+// secrets from, with the credential keys they are taken from in order.
+var agentCredentials = map[string][]credential{
+	"appdynamics": {
+		{name: "APPDYNAMICS_CONTROLLER_HOST_NAME", keys: []string{"host-name"}},
+		{name: "APPDYNAMICS_CONTROLLER_PORT", keys: []string{"port"}},
+		{name: "APPDYNAMICS_CONTROLLER_SSL_ENABLED", keys: []string{"ssl-enabled"}, boolean: true},
+		{name: "APPDYNAMICS_AGENT_ACCOUNT_NAME", keys: []string{"account-name"}},
+		{name: "APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY", keys: []string{"account-access-key"}},
+	},
+	"newrelic": {
+		{name: "NEW_RELIC_LICENSE_KEY", keys: []string{"licenseKey", "license_key"}},
+		{name: "NEW_RELIC_HOST", keys: []string{"collector_host", "host"}},
+		{name: "NEW_RELIC_PROXY_URL", keys: []string{"proxy_url", "proxy"}},
+	},
+}
+
+// AddService records that the hook for agent set up the bound service
+// named service.
+func AddService(depDir, agent, service string) error {
+	services, err := ReadServices(depDir)
+	if err != nil {
+		return err
+	}
+	services[agent] = service
+
+	data, err := json.Marshal(services)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(depDir, ServicesFile), data, 0644)
+}
+
+// ReadServices returns the services AddService recorded, by agent.
+func ReadServices(depDir string) (map[string]string, error) {
+	services := map[string]string{}
+	data, err := ioutil.ReadFile(filepath.Join(depDir, ServicesFile))
+	if os.IsNotExist(err) {
+		return services, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// Services exports the credentials of the services staging set up, by
+// agent, from VCAP_SERVICES as it is at launch. Variables the user already
+// set are left alone. A service that is no longer bound exports nothing,
+// and is named in the warnings.
+func Services(bound map[string]string, lookup func(string) (string, bool)) ([]Var, []string) {
+	type service struct {
+		Name        string                 `json:"name"`
+		Credentials map[string]interface{} `json:"credentials"`
+	}
+
+	var services map[string][]service
+	if value, found := lookup("VCAP_SERVICES"); found {
+		json.Unmarshal([]byte(value), &services)
+	}
+	byName := map[string]map[string]interface{}{}
+	for _, instances := range services {
+		for _, s := range instances {
+			byName[s.Name] = s.Credentials
+		}
+	}
+
+	var agents []string
+	for agent := range bound {
+		agents = append(agents, agent)
+	}
+	sort.Strings(agents)
+
+	var vars []Var
+	var warnings []string
+	for _, agent := range agents {
+		credentials, found := byName[bound[agent]]
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("Service %s is no longer bound, %s is not configured; restage after binding another service", bound[agent], agent))
+			continue
+		}
+
+		for _, c := range agentCredentials[agent] {
+			if existing, found := lookup(c.name); found && existing != "" {
+				continue
+			}
+			if value := credentialValue(credentials, c); value != "" {
+				vars = append(vars, Var{Name: c.name, Value: value})
+			}
+		}
+	}
+	return vars, warnings
+}
+
+func credentialValue(credentials map[string]interface{}, c credential) string {
+	for _, key := range c.keys {
+		var value string
+		switch v := credentials[key].(type) {
+		case nil:
+			continue
+		case string:
+			value = v
+		default:
+			value = fmt.Sprint(v)
+		}
+		if value == "" {
+			continue
+		}
+		if enabled, err := strconv.ParseBool(value); err == nil && c.boolean {
+			value = strconv.FormatBool(enabled)
+		}
+		return value
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package launch_test
+
+import (
+	"io/ioutil"
+	"nodejs/launch"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Services", func() {
+	var (
+		env   map[string]string
+		bound map[string]string
+	)
+
+	lookup := func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+
+	BeforeEach(func() {
+		env = map[string]string{}
+		bound = map[string]string{}
+	})
+
+	It("exports nothing when staging set up no agent", func() {
+		env["VCAP_SERVICES"] = `{"newrelic": [{"name": "nr", "credentials": {"licenseKey": "key1"}}]}`
+		vars, warnings := launch.Services(bound, lookup)
+		Expect(vars).To(BeEmpty())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("ignores malformed VCAP_SERVICES", func() {
+		bound["newrelic"] = "nr"
+		env["VCAP_SERVICES"] = `{"newrelic": [`
+		vars, _ := launch.Services(bound, lookup)
+		Expect(vars).To(BeEmpty())
+	})
+
+	Context("New Relic", func() {
+		BeforeEach(func() {
+			bound["newrelic"] = "nr"
+		})
+
+		It("exports the credentials the service has at launch", func() {
+			env["VCAP_SERVICES"] = `{"newrelic": [{"name": "nr", "credentials": {"license_key": "rotated", "collector_host": "collector.eu.newrelic.com"}}]}`
+			vars, warnings := launch.Services(bound, lookup)
+			Expect(vars).To(Equal([]launch.Var{
+				{Name: "NEW_RELIC_LICENSE_KEY", Value: "rotated"},
+				{Name: "NEW_RELIC_HOST", Value: "collector.eu.newrelic.com"},
+			}))
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("uses the service staging chose when several are bound", func() {
+			env["VCAP_SERVICES"] = `{"newrelic": [{"name": "other", "credentials": {"licenseKey": "key2"}}], "user-provided": [{"name": "nr", "credentials": {"licenseKey": "key1"}}]}`
+			vars, _ := launch.Services(bound, lookup)
+			Expect(vars).To(Equal([]launch.Var{{Name: "NEW_RELIC_LICENSE_KEY", Value: "key1"}}))
+		})
+
+		It("keeps the values the user set", func() {
+			env["VCAP_SERVICES"] = `{"newrelic": [{"name": "nr", "credentials": {"licenseKey": "key1"}}]}`
+			env["NEW_RELIC_LICENSE_KEY"] = "mine"
+			vars, _ := launch.Services(bound, lookup)
+			Expect(vars).To(BeEmpty())
+		})
+
+		It("warns when the service is no longer bound", func() {
+			env["VCAP_SERVICES"] = `{}`
+			vars, warnings := launch.Services(bound, lookup)
+			Expect(vars).To(BeEmpty())
+			Expect(warnings).To(ConsistOf("Service nr is no longer bound, newrelic is not configured; restage after binding another service"))
+		})
+	})
+
+	Context("AppDynamics", func() {
+		BeforeEach(func() {
+			bound["appdynamics"] = "appd"
+		})
+
+		It("exports the controller and account", func() {
+			env["VCAP_SERVICES"] = `{"appdynamics": [{"name": "appd", "credentials": {"host-name": "controller", "port": 443, "account-name": "acct", "ssl-enabled": "True", "account-access-key": "secret"}}]}`
+			vars, _ := launch.Services(bound, lookup)
+			Expect(vars).To(Equal([]launch.Var{
+				{Name: "APPDYNAMICS_CONTROLLER_HOST_NAME", Value: "controller"},
+				{Name: "APPDYNAMICS_CONTROLLER_PORT", Value: "443"},
+				{Name: "APPDYNAMICS_CONTROLLER_SSL_ENABLED", Value: "true"},
+				{Name: "APPDYNAMICS_AGENT_ACCOUNT_NAME", Value: "acct"},
+				{Name: "APPDYNAMICS_AGENT_ACCOUNT_ACCESS_KEY", Value: "secret"},
+			}))
+		})
+
+		It("skips missing credentials", func() {
+			env["VCAP_SERVICES"] = `{"user-provided": [{"name": "appd", "credentials": {"host-name": "controller"}}]}`
+			vars, _ := launch.Services(bound, lookup)
+			Expect(vars).To(Equal([]launch.Var{{Name: "APPDYNAMICS_CONTROLLER_HOST_NAME", Value: "controller"}}))
+		})
+	})
+
+	Describe("AddService", func() {
+		var depDir string
+
+		BeforeEach(func() {
+			var err error
+			depDir, err = ioutil.TempDir("", "nodejs-buildpack.dep.")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(depDir)).To(Succeed())
+		})
+
+		It("records the service of each agent", func() {
+			Expect(launch.ReadServices(depDir)).To(BeEmpty())
+			Expect(launch.AddService(depDir, "newrelic", "nr")).To(Succeed())
+			Expect(launch.AddService(depDir, "appdynamics", "appd")).To(Succeed())
+			Expect(launch.ReadServices(depDir)).To(Equal(map[string]string{"newrelic": "nr", "appdynamics": "appd"}))
+			Expect(filepath.Join(depDir, launch.ServicesFile)).To(BeAnExistingFile())
+		})
+	})
+})
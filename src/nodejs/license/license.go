@@ -0,0 +1,225 @@
+package license
+
+import (
+	"bytes"
+	"fmt"
+	"nodejs/config"
+	"nodejs/inventory"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Policy decides which licenses dependencies may use. With an allow list,
+// only the licenses on it are accepted; the deny list always wins.
+type Policy struct {
+	Allow  []string
+	Deny   []string
+	Action string
+}
+
+// Violation is a package whose license the policy rejects.
+type Violation struct {
+	Package inventory.Package
+	// Path is the chain of dependencies from the app down to the package,
+	// empty when package.json does not lead to it.
+	Path []string
+}
+
+// NewPolicy combines the license_policy from buildpack.yml with the
+// NODE_LICENSE_ALLOW, NODE_LICENSE_DENY and NODE_LICENSE_ACTION env vars,
+// which take precedence so operators can enforce a policy for every app.
+func NewPolicy(fromFile config.LicensePolicy) (Policy, error) {
+	policy := Policy{Allow: fromFile.Allow, Deny: fromFile.Deny, Action: fromFile.Action}
+
+	if allow, found := os.LookupEnv("NODE_LICENSE_ALLOW"); found {
+		policy.Allow = split(allow)
+	}
+	if deny, found := os.LookupEnv("NODE_LICENSE_DENY"); found {
+		policy.Deny = split(deny)
+	}
+	if action, found := os.LookupEnv("NODE_LICENSE_ACTION"); found {
+		policy.Action = action
+	}
+
+	switch policy.Action {
+	case "":
+		policy.Action = "fail"
+	case "warn", "fail":
+	default:
+		return Policy{}, fmt.Errorf("license policy action must be warn or fail, not %s", policy.Action)
+	}
+	return policy, nil
+}
+
+func (p Policy) Empty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// Check returns the packages whose license the policy rejects. buildDir
+// holds the app's package.json, from which dependency paths start.
+func (p Policy) Check(buildDir string, packages []inventory.Package) ([]Violation, error) {
+	var app struct {
+		Name                 string            `json:"name"`
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := libbuildpack.NewJSON().Load(filepath.Join(buildDir, "package.json"), &app); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if app.Name == "" {
+		app.Name = "app"
+	}
+
+	var roots []string
+	for _, deps := range []map[string]string{app.Dependencies, app.OptionalDependencies, app.DevDependencies} {
+		for name := range deps {
+			roots = append(roots, name)
+		}
+	}
+	sort.Strings(roots)
+
+	paths := dependencyPaths(roots, packages)
+
+	var violations []Violation
+	for _, pkg := range packages {
+		if p.accepts(pkg.License) {
+			continue
+		}
+		violation := Violation{Package: pkg}
+		if path, found := paths[pkg.Name]; found {
+			violation.Path = append([]string{app.Name}, path...)
+		}
+		violations = append(violations, violation)
+	}
+	return violations, nil
+}
+
+// accepts evaluates an SPDX expression: either side of an OR may be
+// accepted, both sides of an AND must be. A WITH exception is judged by its
+// license.
+func (p Policy) accepts(expression string) bool {
+	expression = strings.TrimSpace(expression)
+	for strings.HasPrefix(expression, "(") && strings.HasSuffix(expression, ")") && balanced(expression[1:len(expression)-1]) {
+		expression = strings.TrimSpace(expression[1 : len(expression)-1])
+	}
+
+	if left, right, found := splitOutside(expression, " OR "); found {
+		return p.accepts(left) || p.accepts(right)
+	}
+	if left, right, found := splitOutside(expression, " AND "); found {
+		return p.accepts(left) && p.accepts(right)
+	}
+	if idx := strings.Index(expression, " WITH "); idx >= 0 {
+		expression = expression[:idx]
+	}
+
+	if contains(p.Deny, expression) {
+		return false
+	}
+	return len(p.Allow) == 0 || contains(p.Allow, expression)
+}
+
+// Table lays violations out in columns for the staging log.
+func Table(violations []Violation) string {
+	buffer := new(bytes.Buffer)
+	table := tabwriter.NewWriter(buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "PACKAGE\tLICENSE\tDEPENDENCY PATH")
+	for _, v := range violations {
+		license := v.Package.License
+		if license == "" {
+			license = "(none)"
+		}
+		path := strings.Join(v.Path, " > ")
+		if path == "" {
+			path = "(not required by package.json)"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", v.Package.ID(), license, path)
+	}
+	table.Flush()
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// dependencyPaths finds, for every package name, the shortest chain of
+// package names from the app's own dependencies down to it.
+func dependencyPaths(roots []string, packages []inventory.Package) map[string][]string {
+	dependencies := map[string][]string{}
+	for _, pkg := range packages {
+		dependencies[pkg.Name] = append(dependencies[pkg.Name], pkg.Dependencies...)
+	}
+
+	paths := map[string][]string{}
+	var queue []string
+	for _, name := range roots {
+		if _, seen := paths[name]; !seen {
+			paths[name] = []string{name}
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, dep := range dependencies[name] {
+			if _, seen := paths[dep]; seen {
+				continue
+			}
+			paths[dep] = append(append([]string{}, paths[name]...), dep)
+			queue = append(queue, dep)
+		}
+	}
+	return paths
+}
+
+func splitOutside(expression, operator string) (string, string, bool) {
+	depth := 0
+	for i := 0; i < len(expression); i++ {
+		switch expression[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 && strings.HasPrefix(expression[i:], operator) {
+			return expression[:i], expression[i+len(operator):], true
+		}
+	}
+	return "", "", false
+}
+
+func balanced(expression string) bool {
+	depth := 0
+	for _, c := range expression {
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth--; depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+func contains(list []string, id string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func split(list string) []string {
+	var result []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
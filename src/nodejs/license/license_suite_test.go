@@ -0,0 +1,13 @@
+package license_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLicense(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "License Suite")
+}
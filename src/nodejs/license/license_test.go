@@ -0,0 +1,112 @@
+package license_test
+
+import (
+	"io/ioutil"
+	"nodejs/config"
+	"nodejs/inventory"
+	"nodejs/license"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("License", func() {
+	Describe("NewPolicy", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("NODE_LICENSE_ALLOW")).To(Succeed())
+			Expect(os.Unsetenv("NODE_LICENSE_DENY")).To(Succeed())
+			Expect(os.Unsetenv("NODE_LICENSE_ACTION")).To(Succeed())
+		})
+
+		It("uses buildpack.yml and fails by default", func() {
+			policy, err := license.NewPolicy(config.LicensePolicy{Allow: []string{"MIT"}})
+			Expect(err).To(BeNil())
+			Expect(policy).To(Equal(license.Policy{Allow: []string{"MIT"}, Action: "fail"}))
+		})
+
+		It("lets env vars override buildpack.yml", func() {
+			Expect(os.Setenv("NODE_LICENSE_DENY", "GPL-3.0, AGPL-3.0")).To(Succeed())
+			Expect(os.Setenv("NODE_LICENSE_ACTION", "warn")).To(Succeed())
+			policy, err := license.NewPolicy(config.LicensePolicy{Allow: []string{"MIT"}, Deny: []string{"WTFPL"}, Action: "fail"})
+			Expect(err).To(BeNil())
+			Expect(policy).To(Equal(license.Policy{Allow: []string{"MIT"}, Deny: []string{"GPL-3.0", "AGPL-3.0"}, Action: "warn"}))
+		})
+
+		It("rejects unknown actions", func() {
+			Expect(os.Setenv("NODE_LICENSE_ACTION", "block")).To(Succeed())
+			_, err := license.NewPolicy(config.LicensePolicy{})
+			Expect(err).To(MatchError("license policy action must be warn or fail, not block"))
+		})
+	})
+
+	Describe("Check", func() {
+		var (
+			err      error
+			buildDir string
+		)
+
+		BeforeEach(func() {
+			buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(buildDir)).To(Succeed())
+		})
+
+		check := func(policy license.Policy, expression string) bool {
+			violations, err := policy.Check(buildDir, []inventory.Package{{Name: "pkg", Version: "1.0.0", License: expression}})
+			Expect(err).To(BeNil())
+			return len(violations) == 0
+		}
+
+		DescribeTable("evaluating SPDX expressions",
+			func(expression string, accepted bool) {
+				policy := license.Policy{Allow: []string{"MIT", "Apache-2.0", "GPL-2.0"}, Deny: []string{"GPL-3.0"}}
+				Expect(check(policy, expression)).To(Equal(accepted))
+			},
+			Entry("allowed", "MIT", true),
+			Entry("allowed, in another case", "mit", true),
+			Entry("not allowed", "ISC", false),
+			Entry("denied", "GPL-3.0", false),
+			Entry("no license", "", false),
+			Entry("either allowed", "(ISC OR MIT)", true),
+			Entry("neither allowed", "(ISC OR BSD-2-Clause)", false),
+			Entry("both allowed", "MIT AND Apache-2.0", true),
+			Entry("only one allowed", "MIT AND ISC", false),
+			Entry("AND binds tighter than OR", "ISC AND GPL-3.0 OR MIT", true),
+			Entry("nested", "(MIT AND (ISC OR Apache-2.0))", true),
+			Entry("with an exception", "GPL-2.0 WITH Classpath-exception-2.0", true),
+		)
+
+		It("accepts anything not denied without an allow list", func() {
+			policy := license.Policy{Deny: []string{"GPL-3.0"}}
+			Expect(check(policy, "ISC")).To(BeTrue())
+			Expect(check(policy, "")).To(BeTrue())
+			Expect(check(policy, "GPL-3.0")).To(BeFalse())
+		})
+
+		It("reports the dependency path to each violation", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"name": "my-app", "dependencies": {"express": "*"}}`), 0644)).To(Succeed())
+			packages := []inventory.Package{
+				{Name: "express", Version: "4.16.3", License: "MIT", Dependencies: []string{"debug"}},
+				{Name: "debug", Version: "2.6.9", License: "MIT", Dependencies: []string{"ms"}},
+				{Name: "ms", Version: "2.0.0", License: "GPL-3.0"},
+				{Name: "agent", Version: "1.0.0", License: "Proprietary"},
+			}
+
+			violations, err := license.Policy{Allow: []string{"MIT"}}.Check(buildDir, packages)
+			Expect(err).To(BeNil())
+			Expect(violations).To(HaveLen(2))
+			Expect(violations[0].Path).To(Equal([]string{"my-app", "express", "debug", "ms"}))
+
+			Expect(license.Table(violations)).To(Equal(
+				"PACKAGE      LICENSE      DEPENDENCY PATH\n" +
+					"ms@2.0.0     GPL-3.0      my-app > express > debug > ms\n" +
+					"agent@1.0.0  Proprietary  (not required by package.json)"))
+		})
+	})
+})
@@ -0,0 +1,187 @@
+package mirror
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"nodejs/arch"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Mirror is a dist mirror laid out like https://nodejs.org/dist/, with an
+// index.json listing releases and a v<version> directory for each holding
+// the tarballs and their SHASUMS256.txt.
+type Mirror struct {
+	URL string
+	// Arch is the node dist architecture to install, such as x64.
+	Arch string
+}
+
+// FromManifest returns the mirror the operator set as node_dist_mirror in
+// the buildpack's manifest.yml, or nil when there is none. It is not read
+// from the app's environment, since anyone who can push could then point
+// staging at their own node. When stacks are listed, the mirror is only
+// used on those, since its binaries may not run on every stack.
+func FromManifest(manifest *libbuildpack.Manifest) (*Mirror, error) {
+	var settings struct {
+		Mirror struct {
+			URL    string   `yaml:"url"`
+			Stacks []string `yaml:"stacks"`
+		} `yaml:"node_dist_mirror"`
+	}
+	if err := libbuildpack.NewYAML().Load(filepath.Join(manifest.RootDir(), "manifest.yml"), &settings); err != nil {
+		return nil, err
+	}
+
+	mirrorURL := settings.Mirror.URL
+	if mirrorURL == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(mirrorURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("node_dist_mirror.url in manifest.yml must be an https URL")
+	}
+
+	if len(settings.Mirror.Stacks) > 0 {
+		found := false
+		for _, stack := range settings.Mirror.Stacks {
+			if strings.TrimSpace(stack) == os.Getenv("CF_STACK") {
+				found = true
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+
+	return &Mirror{URL: strings.TrimSuffix(mirrorURL, "/"), Arch: arch.Dist(arch.Current())}, nil
+}
+
+func (m *Mirror) String() string {
+	u, err := url.Parse(m.URL)
+	if err != nil || u.User == nil {
+		return m.URL
+	}
+	u.User = url.User("***")
+	return u.String()
+}
+
+// Resolve returns the newest version in the mirror's index.json that
+// matches versionRange and has a linux build for m.Arch.
+func (m *Mirror) Resolve(versionRange string) (string, error) {
+	var releases []struct {
+		Version string   `json:"version"`
+		Files   []string `json:"files"`
+	}
+
+	body, err := m.get("index.json")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(&releases); err != nil {
+		return "", fmt.Errorf("could not parse index.json from %s: %s", m, err)
+	}
+
+	var versions []string
+	for _, release := range releases {
+		for _, file := range release.Files {
+			if file == "linux-"+m.Arch {
+				versions = append(versions, strings.TrimPrefix(release.Version, "v"))
+				break
+			}
+		}
+	}
+
+	version, err := libbuildpack.FindMatchingVersion(versionRange, versions)
+	if err != nil {
+		return "", fmt.Errorf("no node version matching %s for linux-%s in %s", versionRange, m.Arch, m)
+	}
+	return version, nil
+}
+
+// Install downloads the linux tarball of version, checks it against the
+// release's SHASUMS256.txt and extracts it into dir, where it leaves a
+// node-v<version>-linux-<arch> directory.
+func (m *Mirror) Install(version, dir string) error {
+	tarball := fmt.Sprintf("node-v%s-linux-%s.tar.gz", version, m.Arch)
+
+	expected, err := m.checksum(version, tarball)
+	if err != nil {
+		return err
+	}
+
+	body, err := m.get("v" + version + "/" + tarball)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmpFile, err := ioutil.TempFile("", "node-mirror")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpFile, hash), body); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("%s has sha256 %s, but SHASUMS256.txt says %s", tarball, actual, expected)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return libbuildpack.ExtractTarGz(tmpFile.Name(), dir)
+}
+
+func (m *Mirror) checksum(version, tarball string) (string, error) {
+	body, err := m.get("v" + version + "/SHASUMS256.txt")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == tarball {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s is not listed in SHASUMS256.txt for v%s", tarball, version)
+}
+
+func (m *Mirror) get(path string) (io.ReadCloser, error) {
+	client := http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Get(m.URL + "/" + path)
+	if err != nil {
+		// A url.Error repeats the URL, credentials and all, so only its
+		// cause is kept.
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("could not download %s/%s: %s", m, path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("could not download %s/%s: %s", m, path, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,116 @@
+package npm
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type dependencies struct {
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+func (d dependencies) all() map[string]string {
+	all := map[string]string{}
+	for _, deps := range []map[string]string{d.DevDependencies, d.OptionalDependencies, d.Dependencies} {
+		for name, spec := range deps {
+			all[name] = spec
+		}
+	}
+	return all
+}
+
+type lockfile struct {
+	// lockfileVersion 1 only records what was installed.
+	Dependencies map[string]struct {
+		Version string `json:"version"`
+	} `json:"dependencies"`
+	// lockfileVersion 2 and later also record what package.json declared,
+	// under the "" package.
+	Packages map[string]dependencies `json:"packages"`
+}
+
+// checkLockfile fails when package.json declares dependencies its lockfile
+// does not satisfy, since npm ci would refuse to install them. The error
+// lists the differences diff style, lockfile lines first.
+func checkLockfile(buildDir, name string) error {
+	var pkg dependencies
+	if err := libbuildpack.NewJSON().Load(filepath.Join(buildDir, "package.json"), &pkg); err != nil {
+		return fmt.Errorf("could not parse package.json: %s", err)
+	}
+
+	var lock lockfile
+	if err := libbuildpack.NewJSON().Load(filepath.Join(buildDir, name), &lock); err != nil {
+		return fmt.Errorf("could not parse %s: %s", name, err)
+	}
+
+	declared := pkg.all()
+	var diff []string
+	if root, found := lock.Packages[""]; found {
+		locked := root.all()
+		for _, dep := range sortedKeys(declared, locked) {
+			lockedSpec, inLock := locked[dep]
+			declaredSpec, inPkg := declared[dep]
+			if inLock && inPkg && lockedSpec == declaredSpec {
+				continue
+			}
+			if inLock {
+				diff = append(diff, fmt.Sprintf("- %s@%s (%s)", dep, lockedSpec, name))
+			}
+			if inPkg {
+				diff = append(diff, fmt.Sprintf("+ %s@%s (package.json)", dep, declaredSpec))
+			}
+		}
+	} else {
+		for _, dep := range sortedKeys(declared) {
+			entry, inLock := lock.Dependencies[dep]
+			if !inLock {
+				diff = append(diff, fmt.Sprintf("+ %s@%s (package.json, missing from %s)", dep, declared[dep], name))
+			} else if !satisfies(entry.Version, declared[dep]) {
+				diff = append(diff, fmt.Sprintf("- %s@%s (%s)", dep, entry.Version, name))
+				diff = append(diff, fmt.Sprintf("+ %s@%s (package.json)", dep, declared[dep]))
+			}
+		}
+	}
+
+	if len(diff) > 0 {
+		return fmt.Errorf("%s is out of date with package.json. Run npm install and commit %s:\n%s", name, name, strings.Join(diff, "\n"))
+	}
+	return nil
+}
+
+// satisfies reports whether a locked version meets a package.json spec.
+// Specs that are not semver ranges, like tags, git urls or file paths,
+// cannot be checked here and are assumed to match.
+func satisfies(version, spec string) bool {
+	constraint, err := semver.NewConstraint(spec)
+	if err != nil {
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return true
+	}
+	return constraint.Check(v)
+}
+
+func sortedKeys(maps ...map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,45 +1,51 @@
-// Automatically generated by MockGen. DO NOT EDIT!
+// Code generated by MockGen. DO NOT EDIT.
 // Source: npm.go
 
+// Package npm_test is a generated GoMock package.
 package npm_test
 
 import (
 	gomock "github.com/golang/mock/gomock"
 	io "io"
+	reflect "reflect"
 )
 
-// Mock of Command interface
+// MockCommand is a mock of Command interface
 type MockCommand struct {
 	ctrl     *gomock.Controller
-	recorder *_MockCommandRecorder
+	recorder *MockCommandMockRecorder
 }
 
-// Recorder for MockCommand (not exported)
-type _MockCommandRecorder struct {
+// MockCommandMockRecorder is the mock recorder for MockCommand
+type MockCommandMockRecorder struct {
 	mock *MockCommand
 }
 
+// NewMockCommand creates a new mock instance
 func NewMockCommand(ctrl *gomock.Controller) *MockCommand {
 	mock := &MockCommand{ctrl: ctrl}
-	mock.recorder = &_MockCommandRecorder{mock}
+	mock.recorder = &MockCommandMockRecorder{mock}
 	return mock
 }
 
-func (_m *MockCommand) EXPECT() *_MockCommandRecorder {
-	return _m.recorder
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCommand) EXPECT() *MockCommandMockRecorder {
+	return m.recorder
 }
 
-func (_m *MockCommand) Execute(dir string, stdout io.Writer, stderr io.Writer, program string, args ...string) error {
-	_s := []interface{}{dir, stdout, stderr, program}
-	for _, _x := range args {
-		_s = append(_s, _x)
+// Execute mocks base method
+func (m *MockCommand) Execute(dir string, stdout, stderr io.Writer, program string, args ...string) error {
+	varargs := []interface{}{dir, stdout, stderr, program}
+	for _, a := range args {
+		varargs = append(varargs, a)
 	}
-	ret := _m.ctrl.Call(_m, "Execute", _s...)
+	ret := m.ctrl.Call(m, "Execute", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockCommandRecorder) Execute(arg0, arg1, arg2, arg3 interface{}, arg4 ...interface{}) *gomock.Call {
-	_s := append([]interface{}{arg0, arg1, arg2, arg3}, arg4...)
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Execute", _s...)
+// Execute indicates an expected call of Execute
+func (mr *MockCommandMockRecorder) Execute(dir, stdout, stderr, program interface{}, args ...interface{}) *gomock.Call {
+	varargs := append([]interface{}{dir, stdout, stderr, program}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*MockCommand)(nil).Execute), varargs...)
 }
@@ -1,21 +1,35 @@
 package npm
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"nodejs/registry"
+	"nodejs/report"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Masterminds/semver"
 	"github.com/cloudfoundry/libbuildpack"
 )
 
+const ciMinVersion = "5.7.0"
+
+// omitMinVersion is the first npm to take --omit=dev, which replaced
+// --production.
+const omitMinVersion = "7.0.0"
+
 type Command interface {
 	Execute(dir string, stdout io.Writer, stderr io.Writer, program string, args ...string) error
 }
 
 type NPM struct {
-	Command Command
-	Log     *libbuildpack.Logger
+	Command  Command
+	Log      *libbuildpack.Logger
+	Report   *report.Report
+	Registry *registry.Config
 }
 
 func (n *NPM) Build(buildDir, cacheDir string) error {
@@ -27,12 +41,71 @@ func (n *NPM) Build(buildDir, cacheDir string) error {
 		return nil
 	}
 
-	n.Log.Info("Installing node modules (%s)", source)
-	npmArgs := []string{"install", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}
+	subcommand := "install"
+	if lockfile, err := lockfileName(buildDir); err != nil {
+		return err
+	} else if lockfile != "" {
+		if supported, version, err := n.supportsCI(buildDir); err != nil {
+			return err
+		} else if supported {
+			if err := checkLockfile(buildDir, lockfile); err != nil {
+				return err
+			}
+			subcommand = "ci"
+		} else {
+			n.Log.Warning("npm %s does not support npm ci (added in npm %s), running npm install instead. Installed versions may differ from %s.", version, ciMinVersion, lockfile)
+		}
+	}
+
+	n.Log.Info("Installing node modules with npm %s (%s)", subcommand, source)
+	n.Report.SetInstallMode(subcommand)
+	npmArgs := []string{subcommand, "--unsafe-perm", "--userconfig", n.Registry.NPMRC(filepath.Join(buildDir, ".npmrc")), "--cache", filepath.Join(cacheDir, ".npm")}
 	return n.Command.Execute(buildDir, n.Log.Output(), n.Log.Output(), "npm", npmArgs...)
 }
 
-func (n *NPM) Rebuild(buildDir string) error {
+func (n *NPM) supportsCI(buildDir string) (bool, string, error) {
+	v, err := n.version(buildDir)
+	if err != nil {
+		return false, "", err
+	}
+	return !v.LessThan(semver.MustParse(ciMinVersion)), v.Original(), nil
+}
+
+// Prune removes devDependencies from node_modules, once the build scripts
+// that needed them have run.
+func (n *NPM) Prune(buildDir, cacheDir string) error {
+	v, err := n.version(buildDir)
+	if err != nil {
+		return err
+	}
+
+	omit := "--omit=dev"
+	if v.LessThan(semver.MustParse(omitMinVersion)) {
+		omit = "--production"
+	}
+
+	n.Log.Info("Pruning devDependencies with npm prune %s", omit)
+	npmArgs := []string{"prune", omit, "--userconfig", n.Registry.NPMRC(filepath.Join(buildDir, ".npmrc")), "--cache", filepath.Join(cacheDir, ".npm")}
+	return n.Command.Execute(buildDir, n.Log.Output(), n.Log.Output(), "npm", npmArgs...)
+}
+
+func (n *NPM) version(buildDir string) (*semver.Version, error) {
+	buffer := new(bytes.Buffer)
+	if err := n.Command.Execute(buildDir, buffer, ioutil.Discard, "npm", "--version"); err != nil {
+		return nil, err
+	}
+
+	version := strings.TrimSpace(buffer.String())
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse npm version %s: %s", version, err)
+	}
+	return v, nil
+}
+
+// Rebuild rebuilds the native addons of packages, or of every package when
+// none are named, then installs any modules missing from node_modules.
+func (n *NPM) Rebuild(buildDir string, packages ...string) error {
 	doBuild, source, err := n.doBuild(buildDir)
 	if err != nil {
 		return err
@@ -41,13 +114,19 @@ func (n *NPM) Rebuild(buildDir string) error {
 		return nil
 	}
 
-	n.Log.Info("Rebuilding any native modules")
-	if err := n.Command.Execute(buildDir, n.Log.Output(), n.Log.Output(), "npm", "rebuild", "--nodedir="+os.Getenv("NODE_HOME")); err != nil {
+	rebuildArgs := []string{"rebuild", "--nodedir=" + os.Getenv("NODE_HOME")}
+	if len(packages) > 0 {
+		n.Log.Info("Rebuilding native modules of %s", strings.Join(packages, ", "))
+		rebuildArgs = append(rebuildArgs, packages...)
+	} else {
+		n.Log.Info("Rebuilding any native modules")
+	}
+	if err := n.Command.Execute(buildDir, n.Log.Output(), n.Log.Output(), "npm", rebuildArgs...); err != nil {
 		return err
 	}
 
 	n.Log.Info("Installing any new modules (%s)", source)
-	npmArgs := []string{"install", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc")}
+	npmArgs := []string{"install", "--unsafe-perm", "--userconfig", n.Registry.NPMRC(filepath.Join(buildDir, ".npmrc"))}
 	return n.Command.Execute(buildDir, n.Log.Output(), n.Log.Output(), "npm", npmArgs...)
 }
 
@@ -73,3 +152,16 @@ func (n *NPM) doBuild(buildDir string) (bool, string, error) {
 
 	return true, strings.Join(files, " + "), nil
 }
+
+// lockfileName returns the lockfile npm ci would install from. A shrinkwrap
+// takes precedence over package-lock.json, as it does for npm itself.
+func lockfileName(buildDir string) (string, error) {
+	for _, filename := range []string{"npm-shrinkwrap.json", "package-lock.json"} {
+		if found, err := libbuildpack.FileExists(filepath.Join(buildDir, filename)); err != nil {
+			return "", err
+		} else if found {
+			return filename, nil
+		}
+	}
+	return "", nil
+}
@@ -2,8 +2,11 @@ package npm_test
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	n "nodejs/npm"
+	"nodejs/registry"
+	"nodejs/report"
 	"os"
 	"path/filepath"
 
@@ -56,37 +59,96 @@ var _ = Describe("NPM", func() {
 
 	Describe("Build", func() {
 		Context("package.json exists", func() {
+			var npmVersion string
+
 			BeforeEach(func() {
-				Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte("xxx"), 0644)).To(Succeed())
-				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"install", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}).Return(nil)
+				npmVersion = "6.4.1"
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"dependencies": {"express": "^4.16.0"}, "devDependencies": {"mocha": "5.x"}}`), 0644)).To(Succeed())
+				mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "--version").Do(func(_ string, buffer io.Writer, _ io.Writer, _ string, _ ...string) {
+					buffer.Write([]byte(npmVersion + "\n"))
+				}).AnyTimes()
 			})
 
 			Context("package-lock.json exists", func() {
 				BeforeEach(func() {
-					Expect(ioutil.WriteFile(filepath.Join(buildDir, "package-lock.json"), []byte("yyy"), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "package-lock.json"), []byte(`{"lockfileVersion": 1, "dependencies": {"express": {"version": "4.16.3"}, "mocha": {"version": "5.2.0", "dev": true}}}`), 0644)).To(Succeed())
 				})
 
-				It("runs the install, telling users about shrinkwrap", func() {
+				It("runs npm ci, telling users about the lockfile", func() {
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"ci", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}).Return(nil)
+					npm.Report = report.New()
 					Expect(npm.Build(buildDir, cacheDir)).To(Succeed())
-					Expect(buffer.String()).To(ContainSubstring("Installing node modules (package.json + package-lock.json)"))
+					Expect(buffer.String()).To(ContainSubstring("Installing node modules with npm ci (package.json + package-lock.json)"))
+					Expect(npm.Report.InstallMode).To(Equal("ci"))
+				})
+
+				Context("npm is too old for npm ci", func() {
+					BeforeEach(func() {
+						npmVersion = "5.6.0"
+					})
+
+					It("warns and runs npm install", func() {
+						mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"install", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}).Return(nil)
+						Expect(npm.Build(buildDir, cacheDir)).To(Succeed())
+						Expect(buffer.String()).To(ContainSubstring("**WARNING** npm 5.6.0 does not support npm ci (added in npm 5.7.0), running npm install instead. Installed versions may differ from package-lock.json."))
+					})
+				})
+
+				Context("the lockfile does not satisfy package.json", func() {
+					BeforeEach(func() {
+						Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"dependencies": {"express": "^5.0.0", "lodash": "^4.17.0"}, "devDependencies": {"mocha": "5.x"}}`), 0644)).To(Succeed())
+					})
+
+					It("fails listing the differences", func() {
+						err := npm.Build(buildDir, cacheDir)
+						Expect(err).To(MatchError("package-lock.json is out of date with package.json. Run npm install and commit package-lock.json:\n" +
+							"- express@4.16.3 (package-lock.json)\n" +
+							"+ express@^5.0.0 (package.json)\n" +
+							"+ lodash@^4.17.0 (package.json, missing from package-lock.json)"))
+					})
+				})
+			})
+
+			Context("package-lock.json records what package.json declared", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "package-lock.json"), []byte(`{"lockfileVersion": 2, "packages": {"": {"dependencies": {"express": "^4.15.0", "left-pad": "1.3.0"}, "devDependencies": {"mocha": "5.x"}}}}`), 0644)).To(Succeed())
+				})
+
+				It("fails listing the differences", func() {
+					err := npm.Build(buildDir, cacheDir)
+					Expect(err).To(MatchError("package-lock.json is out of date with package.json. Run npm install and commit package-lock.json:\n" +
+						"- express@^4.15.0 (package-lock.json)\n" +
+						"+ express@^4.16.0 (package.json)\n" +
+						"- left-pad@1.3.0 (package-lock.json)"))
 				})
 			})
 
 			Context("npm-shrinkwrap.json exists", func() {
 				BeforeEach(func() {
-					Expect(ioutil.WriteFile(filepath.Join(buildDir, "npm-shrinkwrap.json"), []byte("yyy"), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(buildDir, "npm-shrinkwrap.json"), []byte(`{"lockfileVersion": 2, "packages": {"": {"dependencies": {"express": "^4.16.0"}, "devDependencies": {"mocha": "5.x"}}}}`), 0644)).To(Succeed())
 				})
 
-				It("runs the install, telling users about shrinkwrap", func() {
+				It("runs npm ci, telling users about shrinkwrap", func() {
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"ci", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}).Return(nil)
 					Expect(npm.Build(buildDir, cacheDir)).To(Succeed())
-					Expect(buffer.String()).To(ContainSubstring("Installing node modules (package.json + npm-shrinkwrap.json)"))
+					Expect(buffer.String()).To(ContainSubstring("Installing node modules with npm ci (package.json + npm-shrinkwrap.json)"))
 				})
 			})
 
 			Context("neither package-lock.json nor npm-shrinkwrap.json exist", func() {
 				It("runs the install", func() {
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"install", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}).Return(nil)
+					Expect(npm.Build(buildDir, cacheDir)).To(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("Installing node modules with npm install (package.json)"))
+				})
+
+				It("uses the generated npmrc when registries are configured", func() {
+					npm.Registry = &registry.Config{}
+					Expect(npm.Registry.Write([]registry.Registry{{URL: "https://npm.example.com/", Token: "abc"}})).To(Succeed())
+					defer npm.Registry.Remove()
+
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"install", "--unsafe-perm", "--userconfig", npm.Registry.NPMRC(""), "--cache", filepath.Join(cacheDir, ".npm")}).Return(nil)
 					Expect(npm.Build(buildDir, cacheDir)).To(Succeed())
-					Expect(buffer.String()).To(ContainSubstring("Installing node modules (package.json)"))
 				})
 			})
 		})
@@ -99,6 +161,29 @@ var _ = Describe("NPM", func() {
 		})
 	})
 
+	Describe("Prune", func() {
+		var npmVersion string
+
+		BeforeEach(func() {
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", "--version").Do(func(_ string, buffer io.Writer, _ io.Writer, _ string, _ ...string) {
+				buffer.Write([]byte(npmVersion + "\n"))
+			})
+		})
+
+		It("omits devDependencies", func() {
+			npmVersion = "8.19.2"
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"prune", "--omit=dev", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}).Return(nil)
+			Expect(npm.Prune(buildDir, cacheDir)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Pruning devDependencies with npm prune --omit=dev"))
+		})
+
+		It("uses --production before npm 7", func() {
+			npmVersion = "6.14.18"
+			mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"prune", "--production", "--userconfig", filepath.Join(buildDir, ".npmrc"), "--cache", filepath.Join(cacheDir, ".npm")}).Return(nil)
+			Expect(npm.Prune(buildDir, cacheDir)).To(Succeed())
+		})
+	})
+
 	Describe("Rebuild", func() {
 		var oldNodeHome string
 
@@ -141,6 +226,19 @@ var _ = Describe("NPM", func() {
 			})
 		})
 
+		Context("packages are named", func() {
+			It("only rebuilds those packages", func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte("xxx"), 0644)).To(Succeed())
+				gomock.InOrder(
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"rebuild", "--nodedir=test_node_home", "bcrypt", "@scope/napi"}).Return(nil),
+					mockCommand.EXPECT().Execute(buildDir, gomock.Any(), gomock.Any(), "npm", []string{"install", "--unsafe-perm", "--userconfig", filepath.Join(buildDir, ".npmrc")}).Return(nil),
+				)
+
+				Expect(npm.Rebuild(buildDir, "bcrypt", "@scope/napi")).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Rebuilding native modules of bcrypt, @scope/napi"))
+			})
+		})
+
 		Context("package.json does not exist", func() {
 			It("skips the install", func() {
 				Expect(npm.Rebuild(buildDir)).To(Succeed())
@@ -0,0 +1,54 @@
+package pnpm
+
+import (
+	"io"
+	"nodejs/registry"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type Command interface {
+	Execute(dir string, stdout io.Writer, stderr io.Writer, program string, args ...string) error
+	Run(cmd *exec.Cmd) error
+}
+
+type PNPM struct {
+	Command  Command
+	Log      *libbuildpack.Logger
+	Registry *registry.Config
+}
+
+func (p *PNPM) Build(buildDir, cacheDir string) error {
+	p.Log.Info("Installing node modules (pnpm-lock.yaml)")
+
+	storeDir := filepath.Join(cacheDir, ".pnpm-store")
+	p.Log.Info("Using pnpm store %s", storeDir)
+
+	installArgs := []string{"install", "--frozen-lockfile", "--store-dir", storeDir}
+
+	cmd := exec.Command("pnpm", installArgs...)
+	cmd.Dir = buildDir
+	cmd.Stdout = p.Log.Output()
+	cmd.Stderr = p.Log.Output()
+	cmd.Env = append(os.Environ(), "npm_config_nodedir="+os.Getenv("NODE_HOME"))
+	cmd.Env = append(cmd.Env, p.Registry.Env(false)...)
+
+	return p.Command.Run(cmd)
+}
+
+// Prune removes devDependencies from node_modules, once the build scripts
+// that needed them have run.
+func (p *PNPM) Prune(buildDir, cacheDir string) error {
+	p.Log.Info("Pruning devDependencies with pnpm prune --prod")
+
+	cmd := exec.Command("pnpm", "prune", "--prod", "--store-dir", filepath.Join(cacheDir, ".pnpm-store"))
+	cmd.Dir = buildDir
+	cmd.Stdout = p.Log.Output()
+	cmd.Stderr = p.Log.Output()
+	cmd.Env = append(os.Environ(), p.Registry.Env(false)...)
+
+	return p.Command.Run(cmd)
+}
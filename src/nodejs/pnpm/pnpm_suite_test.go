@@ -0,0 +1,13 @@
+package pnpm_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPnpm(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pnpm Suite")
+}
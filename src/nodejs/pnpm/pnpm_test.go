@@ -0,0 +1,93 @@
+package pnpm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"nodejs/pnpm"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//go:generate mockgen -source=pnpm.go --destination=mocks_test.go --package=pnpm_test
+
+var _ = Describe("PNPM", func() {
+	var (
+		err         error
+		buildDir    string
+		cacheDir    string
+		p           *pnpm.PNPM
+		logger      *libbuildpack.Logger
+		buffer      *bytes.Buffer
+		mockCtrl    *gomock.Controller
+		mockCommand *MockCommand
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+		cacheDir, err = ioutil.TempDir("", "nodejs-buildpack.cache.")
+		Expect(err).To(BeNil())
+
+		buffer = new(bytes.Buffer)
+
+		logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockCommand = NewMockCommand(mockCtrl)
+
+		p = &pnpm.PNPM{
+			Log:     logger,
+			Command: mockCommand,
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+		Expect(os.RemoveAll(cacheDir)).To(Succeed())
+	})
+
+	Describe("Build", func() {
+		var oldNodeHome string
+
+		BeforeEach(func() {
+			oldNodeHome = os.Getenv("NODE_HOME")
+			Expect(os.Setenv("NODE_HOME", "test_node_home")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("NODE_HOME", oldNodeHome)).To(Succeed())
+		})
+
+		It("runs pnpm install with the store in the cache dir", func() {
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+				Expect(cmd.Args).To(Equal([]string{"pnpm", "install", "--frozen-lockfile", "--store-dir", filepath.Join(cacheDir, ".pnpm-store")}))
+				Expect(cmd.Dir).To(Equal(buildDir))
+				Expect(cmd.Env).To(ContainElement("npm_config_nodedir=test_node_home"))
+			}).Return(nil)
+
+			Expect(p.Build(buildDir, cacheDir)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Installing node modules (pnpm-lock.yaml)"))
+		})
+	})
+
+	Describe("Prune", func() {
+		It("runs pnpm prune --prod against the same store", func() {
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+				Expect(cmd.Args).To(Equal([]string{"pnpm", "prune", "--prod", "--store-dir", filepath.Join(cacheDir, ".pnpm-store")}))
+				Expect(cmd.Dir).To(Equal(buildDir))
+			}).Return(nil)
+
+			Expect(p.Prune(buildDir, cacheDir)).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Pruning devDependencies with pnpm prune --prod"))
+		})
+	})
+})
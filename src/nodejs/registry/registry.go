@@ -0,0 +1,279 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultURL is the public registry, used when a token is given without one.
+const DefaultURL = "https://registry.npmjs.org/"
+
+// Registry is a registry to install packages from, for every package or only
+// those in Scope.
+type Registry struct {
+	Scope      string
+	URL        string
+	Token      string
+	Username   string
+	Password   string
+	AlwaysAuth bool
+	// Source says where the registry was configured, for the staging log.
+	Source string
+}
+
+func (r Registry) String() string {
+	if r.Scope == "" {
+		return fmt.Sprintf("%s (%s)", redact(r.URL), r.Source)
+	}
+	return fmt.Sprintf("%s at %s (%s)", r.Scope, redact(r.URL), r.Source)
+}
+
+// Load collects the registries configured by user-provided services whose
+// name or tags contain "npm-registry", and by env vars: NPM_REGISTRY,
+// NPM_TOKEN and NPM_ALWAYS_AUTH for the default registry, and
+// NPM_REGISTRY_<SCOPE> and NPM_TOKEN_<SCOPE> for a scope. Env vars win over
+// services for the same scope.
+func Load() ([]Registry, error) {
+	byScope := map[string]Registry{}
+
+	fromServices, err := fromServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range fromServices {
+		byScope[r.Scope] = r
+	}
+	for _, r := range fromEnv() {
+		byScope[r.Scope] = r
+	}
+
+	registries := make([]Registry, 0, len(byScope))
+	for _, r := range byScope {
+		registries = append(registries, r)
+	}
+	sort.Slice(registries, func(i, j int) bool { return registries[i].Scope < registries[j].Scope })
+	return registries, nil
+}
+
+func fromServices() ([]Registry, error) {
+	var vcapServices map[string][]struct {
+		Name        string   `json:"name"`
+		Tags        []string `json:"tags"`
+		Credentials struct {
+			Registry   string      `json:"registry"`
+			Scope      string      `json:"scope"`
+			Token      string      `json:"token"`
+			Username   string      `json:"username"`
+			Password   string      `json:"password"`
+			AlwaysAuth interface{} `json:"always_auth"`
+		} `json:"credentials"`
+	}
+	if err := json.Unmarshal([]byte(os.Getenv("VCAP_SERVICES")), &vcapServices); err != nil {
+		return nil, nil
+	}
+
+	var registries []Registry
+	for _, services := range vcapServices {
+		for _, service := range services {
+			if !strings.Contains(strings.Join(append([]string{service.Name}, service.Tags...), " "), "npm-registry") {
+				continue
+			}
+
+			c := service.Credentials
+			if c.Registry == "" {
+				return nil, fmt.Errorf("service %s has no registry in its credentials", service.Name)
+			}
+			alwaysAuth, _ := strconv.ParseBool(fmt.Sprint(c.AlwaysAuth))
+			registries = append(registries, Registry{
+				Scope:      scope(c.Scope),
+				URL:        c.Registry,
+				Token:      c.Token,
+				Username:   c.Username,
+				Password:   c.Password,
+				AlwaysAuth: alwaysAuth,
+				Source:     "service " + service.Name,
+			})
+		}
+	}
+	return registries, nil
+}
+
+func fromEnv() []Registry {
+	var registries []Registry
+
+	registry, token := os.Getenv("NPM_REGISTRY"), os.Getenv("NPM_TOKEN")
+	if registry != "" || token != "" {
+		if registry == "" {
+			registry = DefaultURL
+		}
+		alwaysAuth, _ := strconv.ParseBool(os.Getenv("NPM_ALWAYS_AUTH"))
+		registries = append(registries, Registry{URL: registry, Token: token, AlwaysAuth: alwaysAuth, Source: "NPM_REGISTRY"})
+	}
+
+	for _, env := range os.Environ() {
+		parts := strings.SplitN(env, "=", 2)
+		if !strings.HasPrefix(parts[0], "NPM_REGISTRY_") || len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+		suffix := strings.TrimPrefix(parts[0], "NPM_REGISTRY_")
+		registries = append(registries, Registry{
+			Scope:  scope(strings.Replace(strings.ToLower(suffix), "_", "-", -1)),
+			URL:    parts[1],
+			Token:  os.Getenv("NPM_TOKEN_" + suffix),
+			Source: parts[0],
+		})
+	}
+	return registries
+}
+
+func scope(name string) string {
+	if name == "" || strings.HasPrefix(name, "@") {
+		return name
+	}
+	return "@" + name
+}
+
+// Config is the registry configuration written for one staging. It lives in
+// a temporary directory outside the app, which Remove deletes once
+// dependencies are installed, so credentials never reach the droplet. All
+// methods do nothing on a nil or unwritten *Config.
+type Config struct {
+	dir string
+}
+
+// Write generates an npmrc, read by npm, pnpm and Yarn 1, and a .yarnrc.yml
+// for Yarn 2+.
+func (c *Config) Write(registries []Registry) error {
+	if c == nil || len(registries) == 0 {
+		return nil
+	}
+
+	dir, err := ioutil.TempDir("", "nodejs-buildpack.registry.")
+	if err != nil {
+		return err
+	}
+	c.dir = dir
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ".npmrc"), npmrc(registries), 0600); err != nil {
+		return err
+	}
+	contents, err := yarnrc(registries)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ".yarnrc.yml"), contents, 0600)
+}
+
+// NPMRC returns the generated npmrc, or fallback when none was written.
+func (c *Config) NPMRC(fallback string) string {
+	if c == nil || c.dir == "" {
+		return fallback
+	}
+	return filepath.Join(c.dir, ".npmrc")
+}
+
+// Env returns the variables pointing package managers at the generated
+// files. Yarn 2+ only reads .yarnrc.yml from the project and home
+// directories, so it is given the temporary directory as its home.
+func (c *Config) Env(berry bool) []string {
+	if c == nil || c.dir == "" {
+		return nil
+	}
+	if berry {
+		return []string{"HOME=" + c.dir}
+	}
+	return []string{"NPM_CONFIG_USERCONFIG=" + filepath.Join(c.dir, ".npmrc")}
+}
+
+func (c *Config) Remove() error {
+	if c == nil || c.dir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(c.dir); err != nil {
+		return err
+	}
+	c.dir = ""
+	return nil
+}
+
+func npmrc(registries []Registry) []byte {
+	buffer := new(bytes.Buffer)
+	for _, r := range registries {
+		if r.Scope == "" {
+			fmt.Fprintf(buffer, "registry=%s\n", r.URL)
+			if r.AlwaysAuth {
+				fmt.Fprintln(buffer, "always-auth=true")
+			}
+		} else {
+			fmt.Fprintf(buffer, "%s:registry=%s\n", r.Scope, r.URL)
+		}
+
+		// Credentials are keyed by the registry url without its protocol.
+		prefix := strings.TrimPrefix(strings.TrimPrefix(r.URL, "https:"), "http:")
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		if r.Token != "" {
+			fmt.Fprintf(buffer, "%s:_authToken=%s\n", prefix, r.Token)
+		}
+		if r.Username != "" {
+			fmt.Fprintf(buffer, "%s:username=%s\n", prefix, r.Username)
+			fmt.Fprintf(buffer, "%s:_password=%s\n", prefix, base64.StdEncoding.EncodeToString([]byte(r.Password)))
+		}
+		if r.AlwaysAuth {
+			fmt.Fprintf(buffer, "%s:always-auth=true\n", prefix)
+		}
+	}
+	return buffer.Bytes()
+}
+
+type berryRegistry struct {
+	NPMRegistryServer string `yaml:"npmRegistryServer,omitempty"`
+	NPMAuthToken      string `yaml:"npmAuthToken,omitempty"`
+	NPMAuthIdent      string `yaml:"npmAuthIdent,omitempty"`
+	NPMAlwaysAuth     bool   `yaml:"npmAlwaysAuth,omitempty"`
+}
+
+func yarnrc(registries []Registry) ([]byte, error) {
+	var rc struct {
+		berryRegistry `yaml:",inline"`
+		NPMScopes     map[string]berryRegistry `yaml:"npmScopes,omitempty"`
+	}
+
+	for _, r := range registries {
+		settings := berryRegistry{NPMRegistryServer: strings.TrimSuffix(r.URL, "/"), NPMAuthToken: r.Token, NPMAlwaysAuth: r.AlwaysAuth}
+		if r.Username != "" {
+			settings.NPMAuthIdent = r.Username + ":" + r.Password
+		}
+		if r.Scope == "" {
+			rc.berryRegistry = settings
+		} else {
+			if rc.NPMScopes == nil {
+				rc.NPMScopes = map[string]berryRegistry{}
+			}
+			rc.NPMScopes[strings.TrimPrefix(r.Scope, "@")] = settings
+		}
+	}
+	return yaml.Marshal(rc)
+}
+
+// redact is used when logging a url, which may carry credentials itself.
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User("***")
+	return u.String()
+}
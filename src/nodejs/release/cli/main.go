@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"nodejs/finalize"
+	"nodejs/release"
+	"nodejs/supply"
+	"os"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+func main() {
+	logger := libbuildpack.NewLogger(os.Stderr)
+
+	if len(os.Args) < 2 {
+		logger.Error("Usage: release <build-dir>")
+		os.Exit(2)
+	}
+
+	buildDir := os.Args[1]
+	stager := libbuildpack.NewStager([]string{buildDir, ""}, logger, &libbuildpack.Manifest{})
+
+	r := release.Releaser{
+		Finalizer: &finalize.Finalizer{
+			Stager: stager,
+			Log:    logger,
+		},
+		Supplier: &supply.Supplier{
+			Stager: stager,
+			Log:    libbuildpack.NewLogger(ioutil.Discard),
+		},
+		Log:      logger,
+		BuildDir: buildDir,
+	}
+
+	if err := release.Run(&r, os.Stdout); err != nil {
+		os.Exit(12)
+	}
+}
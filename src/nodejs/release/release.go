@@ -0,0 +1,132 @@
+package release
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"nodejs/finalize"
+	"nodejs/supply"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type Releaser struct {
+	Finalizer *finalize.Finalizer
+	Supplier  *supply.Supplier
+	Log       *libbuildpack.Logger
+	BuildDir  string
+}
+
+func Run(r *Releaser, out io.Writer) error {
+	if err := r.Supplier.LoadConfig(); err != nil {
+		r.Log.Error("Unable to load buildpack.yml: %s", err.Error())
+		return err
+	}
+
+	if err := r.Supplier.SelectWorkspace(); err != nil {
+		r.Log.Error("Unable to select workspace: %s", err.Error())
+		return err
+	}
+	r.Finalizer.Workspace = r.Supplier.Workspace
+
+	if err := r.Finalizer.ReadPackageJSON(); err != nil {
+		r.Log.Error("Failed parsing package.json: %s", err.Error())
+		return err
+	}
+
+	if err := r.Supplier.ReadPackageJSON(); err != nil {
+		r.Log.Error("Failed parsing package.json: %s", err.Error())
+		return err
+	}
+
+	web, err := r.WebCommand()
+	if err != nil {
+		r.Log.Error("Unable to determine web process: %s", err.Error())
+		return err
+	}
+
+	if web == "" {
+		_, err = fmt.Fprint(out, "default_process_types: {}\n")
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "default_process_types:\n  web: %s\n", web)
+	return err
+}
+
+// WebCommand picks the default web process in the same order a developer
+// would expect locally: the start script, then the main entry point or
+// server.js run directly with node. A start_command in buildpack.yml
+// overrides these. Commands taken from a workspace's package.json run from
+// the workspace directory. It returns no command when the Procfile has a web
+// process, which Cloud Foundry runs instead of any default.
+func (r *Releaser) WebCommand() (string, error) {
+	tool := r.Supplier.PackageManager()
+
+	if web, err := procfileWeb(filepath.Join(r.BuildDir, "Procfile")); err != nil {
+		return "", err
+	} else if web != "" {
+		if r.Supplier.Config.StartCommand != "" {
+			r.Log.Warning("The Procfile's web process is used instead of start_command from buildpack.yml")
+		}
+		r.Log.Info("Using web process from Procfile")
+		return "", nil
+	}
+
+	if r.Supplier.Config.StartCommand != "" {
+		r.Log.Info("Using start_command from buildpack.yml")
+		return r.Supplier.Config.StartCommand, nil
+	}
+
+	if r.Finalizer.StartScript != "" {
+		r.Log.Info("Using start script from package.json")
+		return r.inWorkspace(tool + " start"), nil
+	}
+
+	for _, entrypoint := range []string{r.Finalizer.Main, "server.js"} {
+		if entrypoint == "" {
+			continue
+		}
+
+		if found, err := libbuildpack.FileExists(filepath.Join(r.BuildDir, r.Supplier.Workspace, entrypoint)); err != nil {
+			return "", err
+		} else if found {
+			r.Log.Info("Using %s as the entry point", entrypoint)
+			return r.inWorkspace("node " + entrypoint), nil
+		}
+	}
+
+	r.Log.Warning("No start script, Procfile, main or server.js found; defaulting to '%s start'", tool)
+	return r.inWorkspace(tool + " start"), nil
+}
+
+func (r *Releaser) inWorkspace(command string) string {
+	if r.Supplier.Workspace == "" {
+		return command
+	}
+	return fmt.Sprintf("cd %s && %s", r.Supplier.Workspace, command)
+}
+
+func procfileWeb(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "web:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "web:")), nil
+		}
+	}
+
+	return "", scanner.Err()
+}
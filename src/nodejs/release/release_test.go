@@ -0,0 +1,212 @@
+package release_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"nodejs/finalize"
+	"nodejs/release"
+	"nodejs/supply"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/cloudfoundry/libbuildpack/ansicleaner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Release", func() {
+	var (
+		err      error
+		buildDir string
+		releaser *release.Releaser
+		logger   *libbuildpack.Logger
+		buffer   *bytes.Buffer
+		output   *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+
+		buffer = new(bytes.Buffer)
+		output = new(bytes.Buffer)
+		logger = libbuildpack.NewLogger(ansicleaner.New(buffer))
+
+		stager := libbuildpack.NewStager([]string{buildDir, ""}, logger, &libbuildpack.Manifest{})
+
+		releaser = &release.Releaser{
+			Finalizer: &finalize.Finalizer{Stager: stager, Log: logger},
+			Supplier:  &supply.Supplier{Stager: stager, Log: logger},
+			Log:       logger,
+			BuildDir:  buildDir,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	writeFile := func(name, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(buildDir, name)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("Run", func() {
+		Context("package.json has a start script", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{"scripts": {"start": "node app.js"}}`)
+			})
+
+			It("uses npm start", func() {
+				Expect(release.Run(releaser, output)).To(Succeed())
+				Expect(output.String()).To(Equal("default_process_types:\n  web: npm start\n"))
+			})
+
+			Context("the app uses yarn", func() {
+				BeforeEach(func() {
+					writeFile("yarn.lock", "")
+				})
+
+				It("uses yarn start", func() {
+					Expect(release.Run(releaser, output)).To(Succeed())
+					Expect(output.String()).To(Equal("default_process_types:\n  web: yarn start\n"))
+				})
+			})
+
+			Context("a workspace is selected", func() {
+				BeforeEach(func() {
+					writeFile("package.json", `{"workspaces": ["packages/*"]}`)
+					writeFile("packages/api/package.json", `{"name": "@acme/api", "scripts": {"start": "node index.js"}}`)
+					Expect(os.Setenv("NODE_WORKSPACE", "@acme/api")).To(Succeed())
+				})
+
+				AfterEach(func() {
+					Expect(os.Unsetenv("NODE_WORKSPACE")).To(Succeed())
+				})
+
+				It("starts the workspace from its directory", func() {
+					Expect(release.Run(releaser, output)).To(Succeed())
+					Expect(output.String()).To(Equal("default_process_types:\n  web: cd packages/api && npm start\n"))
+				})
+			})
+
+			Context("the app uses pnpm", func() {
+				BeforeEach(func() {
+					writeFile("pnpm-lock.yaml", "")
+				})
+
+				It("uses pnpm start", func() {
+					Expect(release.Run(releaser, output)).To(Succeed())
+					Expect(output.String()).To(Equal("default_process_types:\n  web: pnpm start\n"))
+				})
+			})
+		})
+
+		Context("buildpack.yml configures the web process", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{"scripts": {"start": "node app.js"}}`)
+				writeFile("buildpack.yml", "nodejs:\n  start_command: node --enable-source-maps dist/app.js\n  optimize_memory: true\n")
+			})
+
+			It("uses start_command, leaving the heap size to the launch helper", func() {
+				Expect(release.Run(releaser, output)).To(Succeed())
+				Expect(output.String()).To(Equal("default_process_types:\n  web: node --enable-source-maps dist/app.js\n"))
+			})
+		})
+
+		Context("buildpack.yml is invalid", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{}`)
+				writeFile("buildpack.yml", "nodejs:\n  start: node app.js\n")
+			})
+
+			It("returns an error", func() {
+				Expect(release.Run(releaser, output)).NotTo(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Unable to load buildpack.yml: buildpack.yml: unknown key nodejs.start"))
+			})
+		})
+
+		Context("package.json is invalid", func() {
+			BeforeEach(func() {
+				writeFile("package.json", "not actually JSON")
+			})
+
+			It("returns an error", func() {
+				Expect(release.Run(releaser, output)).NotTo(Succeed())
+				Expect(output.String()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("WebCommand", func() {
+		JustBeforeEach(func() {
+			Expect(releaser.Finalizer.ReadPackageJSON()).To(Succeed())
+			Expect(releaser.Supplier.ReadPackageJSON()).To(Succeed())
+		})
+
+		Context("the app has a Procfile with a web process", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{"main": "index.js"}`)
+				writeFile("index.js", "")
+				writeFile("Procfile", "worker: node worker.js\nweb: node web.js\n")
+			})
+
+			It("leaves the web process to the Procfile", func() {
+				Expect(releaser.WebCommand()).To(Equal(""))
+				Expect(buffer.String()).To(ContainSubstring("Using web process from Procfile"))
+			})
+
+			It("declares no default web process", func() {
+				Expect(release.Run(releaser, output)).To(Succeed())
+				Expect(output.String()).To(Equal("default_process_types: {}\n"))
+			})
+
+			Context("buildpack.yml sets a start_command", func() {
+				BeforeEach(func() {
+					writeFile("buildpack.yml", "nodejs:\n  start_command: node other.js\n")
+					Expect(releaser.Supplier.LoadConfig()).To(Succeed())
+				})
+
+				It("warns that the Procfile wins", func() {
+					Expect(releaser.WebCommand()).To(Equal(""))
+					Expect(buffer.String()).To(ContainSubstring("The Procfile's web process is used instead of start_command from buildpack.yml"))
+				})
+			})
+		})
+
+		Context("package.json has a main entry point", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{"main": "lib/index.js"}`)
+				writeFile("server.js", "")
+			})
+
+			Context("the main file exists", func() {
+				BeforeEach(func() {
+					writeFile("lib/index.js", "")
+				})
+
+				It("runs main with node", func() {
+					Expect(releaser.WebCommand()).To(Equal("node lib/index.js"))
+				})
+			})
+
+			Context("the main file does not exist", func() {
+				It("falls back to server.js", func() {
+					Expect(releaser.WebCommand()).To(Equal("node server.js"))
+				})
+			})
+		})
+
+		Context("the app has no way to start", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{}`)
+			})
+
+			It("falls back to npm start and warns", func() {
+				Expect(releaser.WebCommand()).To(Equal("npm start"))
+				Expect(buffer.String()).To(ContainSubstring("**WARNING** No start script, Procfile, main or server.js found; defaulting to 'npm start'"))
+			})
+		})
+	})
+})
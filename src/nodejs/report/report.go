@@ -0,0 +1,213 @@
+package report
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Filename is the report's name in the dep dir, where it ends up in the
+// droplet next to config.yml.
+const Filename = "staging_report.json"
+
+type Tool struct {
+	Requested string `json:"requested,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Source    string `json:"source"`
+}
+
+type Step struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Report collects what happened while staging. Supply, finalize and the
+// hooks each run in their own process, so every one of them records only its
+// own part and Save merges it into the report already in the dep dir.
+//
+// All methods do nothing on a nil *Report, so callers need not check for one.
+type Report struct {
+	Tools          map[string]Tool   `json:"tools"`
+	PackageManager string            `json:"package_manager,omitempty"`
+	InstallMode    string            `json:"install_mode,omitempty"`
+	Warnings       []string          `json:"warnings"`
+	Hooks          []string          `json:"hooks"`
+	Steps          []Step            `json:"steps"`
+	Cache          map[string]string `json:"cache"`
+
+	step      string
+	stepStart time.Time
+}
+
+func New() *Report {
+	return &Report{Tools: map[string]Tool{}, Cache: map[string]string{}}
+}
+
+// Load reads the report saved so far in depDir, or returns an empty one.
+func Load(depDir string) (*Report, error) {
+	r := New()
+	if err := libbuildpack.NewJSON().Load(filepath.Join(depDir, Filename), r); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if r.Tools == nil {
+		r.Tools = map[string]Tool{}
+	}
+	if r.Cache == nil {
+		r.Cache = map[string]string{}
+	}
+	return r, nil
+}
+
+func (r *Report) SetTool(name, requested, version, source string) {
+	if r == nil {
+		return
+	}
+	r.Tools[name] = Tool{Requested: requested, Version: version, Source: source}
+}
+
+func (r *Report) SetPackageManager(name string) {
+	if r == nil {
+		return
+	}
+	r.PackageManager = name
+}
+
+// SetInstallMode records how dependencies were installed: vendored, cached,
+// rebuild, ci or install.
+func (r *Report) SetInstallMode(mode string) {
+	if r == nil {
+		return
+	}
+	r.InstallMode = mode
+}
+
+// SetCache records whether a cache was a hit, a miss, or disabled.
+func (r *Report) SetCache(name, result string) {
+	if r == nil {
+		return
+	}
+	r.Cache[name] = result
+}
+
+func (r *Report) Warn(message string) {
+	if r == nil {
+		return
+	}
+	r.Warnings = append(r.Warnings, message)
+}
+
+// BeginStep ends the running step, if any, and times a new one.
+func (r *Report) BeginStep(name string) {
+	if r == nil {
+		return
+	}
+	r.EndStep()
+	r.step = name
+	r.stepStart = time.Now()
+}
+
+func (r *Report) EndStep() {
+	if r == nil || r.step == "" {
+		return
+	}
+	r.Steps = append(r.Steps, Step{Name: r.step, Seconds: time.Since(r.stepStart).Seconds()})
+	r.step = ""
+}
+
+// Save ends the running step and merges the report into depDir/Filename.
+// Tools and caches replace earlier entries of the same name, everything else
+// is appended. The report is emptied so saving it again adds nothing twice.
+func (r *Report) Save(depDir string) error {
+	if r == nil {
+		return nil
+	}
+	r.EndStep()
+
+	saved, err := Load(depDir)
+	if err != nil {
+		return err
+	}
+
+	for name, tool := range r.Tools {
+		saved.Tools[name] = tool
+	}
+	for name, result := range r.Cache {
+		saved.Cache[name] = result
+	}
+	if r.PackageManager != "" {
+		saved.PackageManager = r.PackageManager
+	}
+	if r.InstallMode != "" {
+		saved.InstallMode = r.InstallMode
+	}
+	saved.Warnings = append(saved.Warnings, r.Warnings...)
+	saved.Hooks = append(saved.Hooks, r.Hooks...)
+	saved.Steps = append(saved.Steps, r.Steps...)
+
+	if err := libbuildpack.NewJSON().Write(filepath.Join(depDir, Filename), saved); err != nil {
+		return err
+	}
+
+	*r = *New()
+	return nil
+}
+
+// AddHook records that a hook found its service and ran.
+func AddHook(depDir, name string) error {
+	r := New()
+	r.Hooks = append(r.Hooks, name)
+	return r.Save(depDir)
+}
+
+var ansiCodes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+type logWatcher struct {
+	w       io.Writer
+	r       *Report
+	partial []byte
+}
+
+// Writer passes everything on to w and records the warnings and steps a
+// libbuildpack.Logger writes through it. Only the first line of a multi line
+// warning is kept.
+func (r *Report) Writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &logWatcher{w: w, r: r}
+}
+
+func (l *logWatcher) Write(p []byte) (int, error) {
+	n, err := l.w.Write(p)
+
+	l.partial = append(l.partial, p[:n]...)
+	for {
+		idx := bytes.IndexByte(l.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		l.watch(string(l.partial[:idx]))
+		l.partial = l.partial[idx+1:]
+	}
+
+	return n, err
+}
+
+func (l *logWatcher) watch(line string) {
+	line = ansiCodes.ReplaceAllString(line, "")
+	if strings.HasPrefix(line, "-----> ") {
+		l.r.BeginStep(strings.TrimPrefix(line, "-----> "))
+		return
+	}
+
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "**WARNING** ") {
+		l.r.Warn(strings.TrimPrefix(line, "**WARNING** "))
+	}
+}
@@ -0,0 +1,118 @@
+package report_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"nodejs/report"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Report", func() {
+	var (
+		err    error
+		depDir string
+		r      *report.Report
+	)
+
+	BeforeEach(func() {
+		depDir, err = ioutil.TempDir("", "nodejs-buildpack.dep.")
+		Expect(err).To(BeNil())
+		r = report.New()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(depDir)).To(Succeed())
+	})
+
+	load := func() *report.Report {
+		saved := report.New()
+		Expect(libbuildpack.NewJSON().Load(filepath.Join(depDir, "staging_report.json"), saved)).To(Succeed())
+		return saved
+	}
+
+	It("writes the report to the dep dir", func() {
+		r.SetTool("node", "10.x", "10.16.0", "package.json")
+		r.SetPackageManager("npm")
+		r.SetInstallMode("ci")
+		r.SetCache("node_modules", "miss")
+		Expect(r.Save(depDir)).To(Succeed())
+
+		saved := load()
+		Expect(saved.Tools).To(Equal(map[string]report.Tool{"node": {Requested: "10.x", Version: "10.16.0", Source: "package.json"}}))
+		Expect(saved.PackageManager).To(Equal("npm"))
+		Expect(saved.InstallMode).To(Equal("ci"))
+		Expect(saved.Cache).To(Equal(map[string]string{"node_modules": "miss"}))
+	})
+
+	It("merges into a report saved earlier", func() {
+		r.SetTool("node", "", "10.16.0", "default")
+		r.Warn("from supply")
+		Expect(r.Save(depDir)).To(Succeed())
+
+		Expect(report.AddHook(depDir, "dynatrace")).To(Succeed())
+
+		finalize := report.New()
+		finalize.Warn("from finalize")
+		Expect(finalize.Save(depDir)).To(Succeed())
+
+		saved := load()
+		Expect(saved.Tools).To(HaveKey("node"))
+		Expect(saved.Hooks).To(Equal([]string{"dynatrace"}))
+		Expect(saved.Warnings).To(Equal([]string{"from supply", "from finalize"}))
+	})
+
+	It("does not save anything twice", func() {
+		r.Warn("once")
+		Expect(r.Save(depDir)).To(Succeed())
+		Expect(r.Save(depDir)).To(Succeed())
+		Expect(load().Warnings).To(Equal([]string{"once"}))
+	})
+
+	Describe("Writer", func() {
+		var (
+			output *bytes.Buffer
+			logger *libbuildpack.Logger
+		)
+
+		BeforeEach(func() {
+			output = new(bytes.Buffer)
+			logger = libbuildpack.NewLogger(r.Writer(output))
+		})
+
+		It("passes output through", func() {
+			logger.Info("hello")
+			Expect(output.String()).To(Equal("       hello\n"))
+		})
+
+		It("records warnings", func() {
+			logger.Info("not a warning")
+			logger.Warning("first line\nsecond line")
+			Expect(r.Warnings).To(Equal([]string{"first line"}))
+		})
+
+		It("times steps", func() {
+			logger.BeginStep("Installing binaries")
+			logger.Info("installing")
+			logger.BeginStep("Building dependencies")
+			Expect(r.Save(depDir)).To(Succeed())
+
+			steps := load().Steps
+			Expect(steps).To(HaveLen(2))
+			Expect(steps[0].Name).To(Equal("Installing binaries"))
+			Expect(steps[1].Name).To(Equal("Building dependencies"))
+		})
+	})
+
+	It("ignores a nil report", func() {
+		var nothing *report.Report
+		nothing.Warn("ignored")
+		nothing.SetTool("node", "", "", "")
+		Expect(nothing.Save(depDir)).To(Succeed())
+		Expect(filepath.Join(depDir, "staging_report.json")).ToNot(BeAnExistingFile())
+	})
+})
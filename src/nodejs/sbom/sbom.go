@@ -0,0 +1,200 @@
+package sbom
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"nodejs/inventory"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// Filename is the SBOM's name in the dep dir.
+const Filename = "sbom.cdx.json"
+
+const specVersion = "1.4"
+
+type BOM struct {
+	BOMFormat    string      `json:"bomFormat"`
+	SpecVersion  string      `json:"specVersion"`
+	SerialNumber string      `json:"serialNumber"`
+	Version      int         `json:"version"`
+	Metadata     Metadata    `json:"metadata"`
+	Components   []Component `json:"components"`
+}
+
+type Metadata struct {
+	Timestamp string     `json:"timestamp"`
+	Tools     []Tool     `json:"tools"`
+	Component *Component `json:"component,omitempty"`
+}
+
+type Tool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type Component struct {
+	Type     string    `json:"type"`
+	BOMRef   string    `json:"bom-ref,omitempty"`
+	Group    string    `json:"group,omitempty"`
+	Name     string    `json:"name"`
+	Version  string    `json:"version,omitempty"`
+	Licenses []License `json:"licenses,omitempty"`
+	Hashes   []Hash    `json:"hashes,omitempty"`
+	PURL     string    `json:"purl,omitempty"`
+}
+
+// License holds either a single license, or an SPDX expression combining
+// several.
+type License struct {
+	License    *LicenseChoice `json:"license,omitempty"`
+	Expression string         `json:"expression,omitempty"`
+}
+
+type LicenseChoice struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type Hash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+// New starts a BOM for the app, generated by the buildpack at
+// buildpackVersion.
+func New(appName, appVersion, buildpackVersion string) (*BOM, error) {
+	serial, err := uuid()
+	if err != nil {
+		return nil, err
+	}
+
+	bom := &BOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  specVersion,
+		SerialNumber: "urn:uuid:" + serial,
+		Version:      1,
+		Metadata: Metadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools:     []Tool{{Vendor: "Cloud Foundry", Name: "nodejs-buildpack", Version: buildpackVersion}},
+		},
+		Components: []Component{},
+	}
+	if appName != "" {
+		bom.Metadata.Component = &Component{Type: "application", Name: appName, Version: appVersion}
+	}
+	return bom, nil
+}
+
+// AddTool records the node runtime or a package manager. npm, yarn and pnpm
+// are npm packages themselves, node is not.
+func (b *BOM) AddTool(name, version string) {
+	purl := "pkg:generic/" + name + "@" + url.PathEscape(version)
+	if name != "node" {
+		purl = npmPURL(name, version)
+	}
+	b.Components = append(b.Components, Component{
+		Type:    "application",
+		BOMRef:  purl,
+		Name:    name,
+		Version: version,
+		PURL:    purl,
+	})
+}
+
+func (b *BOM) AddPackages(packages []inventory.Package) {
+	for _, pkg := range packages {
+		purl := npmPURL(pkg.Name, pkg.Version)
+		component := Component{
+			Type:     "library",
+			BOMRef:   purl,
+			Name:     pkg.Name,
+			Version:  pkg.Version,
+			Licenses: licenses(pkg.License),
+			Hashes:   hashes(pkg.Integrity),
+			PURL:     purl,
+		}
+		if strings.HasPrefix(pkg.Name, "@") {
+			if idx := strings.Index(pkg.Name, "/"); idx > 0 {
+				component.Group = pkg.Name[:idx]
+				component.Name = pkg.Name[idx+1:]
+			}
+		}
+		b.Components = append(b.Components, component)
+	}
+}
+
+func (b *BOM) Write(path string) error {
+	return libbuildpack.NewJSON().Write(path, b)
+}
+
+// npmPURL builds a package url, in which the @ of a scope is escaped.
+func npmPURL(name, version string) string {
+	escaped := url.PathEscape(name)
+	if strings.HasPrefix(name, "@") {
+		if idx := strings.Index(name, "/"); idx > 0 {
+			escaped = "%40" + url.PathEscape(name[1:idx]) + "/" + url.PathEscape(name[idx+1:])
+		}
+	}
+	return "pkg:npm/" + escaped + "@" + url.PathEscape(version)
+}
+
+var spdxID = regexp.MustCompile(`^[A-Za-z0-9.+-]+$`)
+
+func licenses(license string) []License {
+	switch {
+	case license == "":
+		return nil
+	case spdxID.MatchString(license):
+		return []License{{License: &LicenseChoice{ID: license}}}
+	case strings.Contains(license, " OR ") || strings.Contains(license, " AND ") || strings.Contains(license, " WITH "):
+		return []License{{Expression: license}}
+	}
+	return []License{{License: &LicenseChoice{Name: license}}}
+}
+
+var hashAlgorithms = map[string]string{
+	"sha1":   "SHA-1",
+	"sha256": "SHA-256",
+	"sha384": "SHA-384",
+	"sha512": "SHA-512",
+}
+
+// hashes converts a subresource integrity string, which may hold several
+// space separated hashes, to hex encoded CycloneDX hashes.
+func hashes(integrity string) []Hash {
+	var result []Hash
+	for _, sri := range strings.Fields(integrity) {
+		parts := strings.SplitN(sri, "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		alg, found := hashAlgorithms[parts[0]]
+		if !found {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			continue
+		}
+		result = append(result, Hash{Alg: alg, Content: hex.EncodeToString(digest)})
+	}
+	return result
+}
+
+func uuid() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,94 @@
+package sbom_test
+
+import (
+	"io/ioutil"
+	"nodejs/inventory"
+	"nodejs/sbom"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/libbuildpack"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SBOM", func() {
+	var (
+		err error
+		dir string
+		bom *sbom.BOM
+	)
+
+	BeforeEach(func() {
+		dir, err = ioutil.TempDir("", "nodejs-buildpack.sbom.")
+		Expect(err).To(BeNil())
+		bom, err = sbom.New("my-app", "1.0.0", "1.6.40")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("describes the app and the buildpack", func() {
+		Expect(bom.BOMFormat).To(Equal("CycloneDX"))
+		Expect(bom.SerialNumber).To(MatchRegexp(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+		Expect(bom.Metadata.Component).To(Equal(&sbom.Component{Type: "application", Name: "my-app", Version: "1.0.0"}))
+		Expect(bom.Metadata.Tools).To(Equal([]sbom.Tool{{Vendor: "Cloud Foundry", Name: "nodejs-buildpack", Version: "1.6.40"}}))
+	})
+
+	It("adds node and the package managers", func() {
+		bom.AddTool("node", "10.16.0")
+		bom.AddTool("npm", "6.9.0")
+		Expect(bom.Components[0].PURL).To(Equal("pkg:generic/node@10.16.0"))
+		Expect(bom.Components[1].PURL).To(Equal("pkg:npm/npm@6.9.0"))
+	})
+
+	It("adds packages with licenses, hashes and purls", func() {
+		bom.AddPackages([]inventory.Package{
+			{Name: "@babel/core", Version: "7.0.0", License: "(MIT OR Apache-2.0)", Integrity: "sha1-AAEC sha512-/w=="},
+			{Name: "express", Version: "4.16.3", License: "MIT"},
+			{Name: "odd", Version: "1.0.0", License: "SEE LICENSE IN LICENSE.txt"},
+		})
+
+		Expect(bom.Components).To(Equal([]sbom.Component{
+			{
+				Type:     "library",
+				BOMRef:   "pkg:npm/%40babel/core@7.0.0",
+				Group:    "@babel",
+				Name:     "core",
+				Version:  "7.0.0",
+				Licenses: []sbom.License{{Expression: "(MIT OR Apache-2.0)"}},
+				Hashes:   []sbom.Hash{{Alg: "SHA-1", Content: "000102"}, {Alg: "SHA-512", Content: "ff"}},
+				PURL:     "pkg:npm/%40babel/core@7.0.0",
+			},
+			{
+				Type:     "library",
+				BOMRef:   "pkg:npm/express@4.16.3",
+				Name:     "express",
+				Version:  "4.16.3",
+				Licenses: []sbom.License{{License: &sbom.LicenseChoice{ID: "MIT"}}},
+				PURL:     "pkg:npm/express@4.16.3",
+			},
+			{
+				Type:     "library",
+				BOMRef:   "pkg:npm/odd@1.0.0",
+				Name:     "odd",
+				Version:  "1.0.0",
+				Licenses: []sbom.License{{License: &sbom.LicenseChoice{Name: "SEE LICENSE IN LICENSE.txt"}}},
+				PURL:     "pkg:npm/odd@1.0.0",
+			},
+		}))
+	})
+
+	It("writes JSON", func() {
+		bom.AddTool("node", "10.16.0")
+		Expect(bom.Write(filepath.Join(dir, sbom.Filename))).To(Succeed())
+
+		var written map[string]interface{}
+		Expect(libbuildpack.NewJSON().Load(filepath.Join(dir, "sbom.cdx.json"), &written)).To(Succeed())
+		Expect(written["bomFormat"]).To(Equal("CycloneDX"))
+		Expect(written["specVersion"]).To(Equal("1.4"))
+		Expect(written["components"]).To(HaveLen(1))
+	})
+})
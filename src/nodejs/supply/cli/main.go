@@ -3,11 +3,18 @@ package main
 import (
 	"io"
 	"io/ioutil"
-	_ "nodejs/hooks"
+	"nodejs/arch"
+	"nodejs/certs"
+	"nodejs/hooks"
+	"nodejs/mirror"
 	"nodejs/npm"
+	"nodejs/pnpm"
+	"nodejs/registry"
+	"nodejs/report"
 	"nodejs/supply"
 	"nodejs/yarn"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
@@ -22,8 +29,10 @@ func main() {
 		os.Exit(8)
 	}
 
+	rep := report.New()
 	stdout := io.MultiWriter(os.Stdout, logfile)
-	logger := libbuildpack.NewLogger(stdout)
+	logger := libbuildpack.NewLogger(rep.Writer(stdout))
+	hooks.SetOutput(rep.Writer(stdout))
 
 	buildpackDir, err := libbuildpack.GetBuildpackDir()
 	if err != nil {
@@ -50,6 +59,24 @@ func main() {
 		logger.Error("Unable to apply override.yml files: %s", err)
 		os.Exit(17)
 	}
+	if dropped, err := arch.Filter(manifest, stager.DepsDir(), arch.Current()); err != nil {
+		logger.Error("Unable to select dependencies: %s", err)
+		os.Exit(21)
+	} else if dropped > 0 {
+		logger.Debug("Ignoring %d dependencies built for other architectures than %s", dropped, arch.Current())
+	}
+
+	trust, err := certs.Configure(stager.DepsDir(), stager.DepDir())
+	if err != nil {
+		logger.Error("Unable to configure CA certificates: %s", err.Error())
+		os.Exit(20)
+	}
+	if trust.Count > 0 {
+		logger.Info("Trusting %d extra CA certificates from %s", trust.Count, strings.Join(trust.Sources, ", "))
+	}
+	if trust.Insecure {
+		logger.Warning("NODE_TLS_INSECURE is set, TLS certificates will not be verified while staging")
+	}
 
 	err = libbuildpack.RunBeforeCompile(stager)
 	if err != nil {
@@ -63,23 +90,43 @@ func main() {
 		os.Exit(13)
 	}
 
+	reg := &registry.Config{}
 	s := supply.Supplier{
 		Logfile: logfile,
 		Stager:  stager,
 		Yarn: &yarn.Yarn{
-			Command: &libbuildpack.Command{},
-			Log:     logger,
+			Command:  &libbuildpack.Command{},
+			Log:      logger,
+			Registry: reg,
 		},
 		NPM: &npm.NPM{
-			Command: &libbuildpack.Command{},
-			Log:     logger,
+			Command:  &libbuildpack.Command{},
+			Log:      logger,
+			Report:   rep,
+			Registry: reg,
+		},
+		PNPM: &pnpm.PNPM{
+			Command:  &libbuildpack.Command{},
+			Log:      logger,
+			Registry: reg,
 		},
 		Manifest: manifest,
 		Log:      logger,
 		Command:  &libbuildpack.Command{},
+		Report:   rep,
+		Registry: reg,
+	}
+	if distMirror, err := mirror.FromManifest(manifest); err != nil {
+		logger.Error("Unable to read node_dist_mirror: %s", err.Error())
+		os.Exit(22)
+	} else if distMirror != nil {
+		s.Mirror = distMirror
 	}
 
 	err = supply.Run(&s)
+	if err := rep.Save(stager.DepDir()); err != nil {
+		logger.Error("Unable to write %s: %s", report.Filename, err.Error())
+	}
 	if err != nil {
 		os.Exit(14)
 	}
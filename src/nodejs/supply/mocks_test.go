@@ -99,6 +99,18 @@ func (mr *MockManifestMockRecorder) DefaultVersion(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DefaultVersion", reflect.TypeOf((*MockManifest)(nil).DefaultVersion), arg0)
 }
 
+// FetchDependency mocks base method
+func (m *MockManifest) FetchDependency(arg0 libbuildpack.Dependency, arg1 string) error {
+	ret := m.ctrl.Call(m, "FetchDependency", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FetchDependency indicates an expected call of FetchDependency
+func (mr *MockManifestMockRecorder) FetchDependency(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchDependency", reflect.TypeOf((*MockManifest)(nil).FetchDependency), arg0, arg1)
+}
+
 // InstallDependency mocks base method
 func (m *MockManifest) InstallDependency(arg0 libbuildpack.Dependency, arg1 string) error {
 	ret := m.ctrl.Call(m, "InstallDependency", arg0, arg1)
@@ -123,6 +135,78 @@ func (mr *MockManifestMockRecorder) InstallOnlyVersion(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstallOnlyVersion", reflect.TypeOf((*MockManifest)(nil).InstallOnlyVersion), arg0, arg1)
 }
 
+// RootDir mocks base method
+func (m *MockManifest) RootDir() string {
+	ret := m.ctrl.Call(m, "RootDir")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// RootDir indicates an expected call of RootDir
+func (mr *MockManifestMockRecorder) RootDir() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RootDir", reflect.TypeOf((*MockManifest)(nil).RootDir))
+}
+
+// MockMirror is a mock of Mirror interface
+type MockMirror struct {
+	ctrl     *gomock.Controller
+	recorder *MockMirrorMockRecorder
+}
+
+// MockMirrorMockRecorder is the mock recorder for MockMirror
+type MockMirrorMockRecorder struct {
+	mock *MockMirror
+}
+
+// NewMockMirror creates a new mock instance
+func NewMockMirror(ctrl *gomock.Controller) *MockMirror {
+	mock := &MockMirror{ctrl: ctrl}
+	mock.recorder = &MockMirrorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockMirror) EXPECT() *MockMirrorMockRecorder {
+	return m.recorder
+}
+
+// Resolve mocks base method
+func (m *MockMirror) Resolve(arg0 string) (string, error) {
+	ret := m.ctrl.Call(m, "Resolve", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Resolve indicates an expected call of Resolve
+func (mr *MockMirrorMockRecorder) Resolve(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resolve", reflect.TypeOf((*MockMirror)(nil).Resolve), arg0)
+}
+
+// Install mocks base method
+func (m *MockMirror) Install(arg0, arg1 string) error {
+	ret := m.ctrl.Call(m, "Install", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Install indicates an expected call of Install
+func (mr *MockMirrorMockRecorder) Install(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Install", reflect.TypeOf((*MockMirror)(nil).Install), arg0, arg1)
+}
+
+// String mocks base method
+func (m *MockMirror) String() string {
+	ret := m.ctrl.Call(m, "String")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// String indicates an expected call of String
+func (mr *MockMirrorMockRecorder) String() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "String", reflect.TypeOf((*MockMirror)(nil).String))
+}
+
 // MockNPM is a mock of NPM interface
 type MockNPM struct {
 	ctrl     *gomock.Controller
@@ -159,15 +243,32 @@ func (mr *MockNPMMockRecorder) Build(arg0, arg1 interface{}) *gomock.Call {
 }
 
 // Rebuild mocks base method
-func (m *MockNPM) Rebuild(arg0 string) error {
-	ret := m.ctrl.Call(m, "Rebuild", arg0)
+func (m *MockNPM) Rebuild(arg0 string, arg1 ...string) error {
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Rebuild", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Rebuild indicates an expected call of Rebuild
-func (mr *MockNPMMockRecorder) Rebuild(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rebuild", reflect.TypeOf((*MockNPM)(nil).Rebuild), arg0)
+func (mr *MockNPMMockRecorder) Rebuild(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rebuild", reflect.TypeOf((*MockNPM)(nil).Rebuild), varargs...)
+}
+
+// Prune mocks base method
+func (m *MockNPM) Prune(arg0, arg1 string) error {
+	ret := m.ctrl.Call(m, "Prune", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prune indicates an expected call of Prune
+func (mr *MockNPMMockRecorder) Prune(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockNPM)(nil).Prune), arg0, arg1)
 }
 
 // MockYarn is a mock of Yarn interface
@@ -205,6 +306,65 @@ func (mr *MockYarnMockRecorder) Build(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Build", reflect.TypeOf((*MockYarn)(nil).Build), arg0, arg1)
 }
 
+// Prune mocks base method
+func (m *MockYarn) Prune(arg0, arg1 string) error {
+	ret := m.ctrl.Call(m, "Prune", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prune indicates an expected call of Prune
+func (mr *MockYarnMockRecorder) Prune(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockYarn)(nil).Prune), arg0, arg1)
+}
+
+// MockPNPM is a mock of PNPM interface
+type MockPNPM struct {
+	ctrl     *gomock.Controller
+	recorder *MockPNPMMockRecorder
+}
+
+// MockPNPMMockRecorder is the mock recorder for MockPNPM
+type MockPNPMMockRecorder struct {
+	mock *MockPNPM
+}
+
+// NewMockPNPM creates a new mock instance
+func NewMockPNPM(ctrl *gomock.Controller) *MockPNPM {
+	mock := &MockPNPM{ctrl: ctrl}
+	mock.recorder = &MockPNPMMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockPNPM) EXPECT() *MockPNPMMockRecorder {
+	return m.recorder
+}
+
+// Build mocks base method
+func (m *MockPNPM) Build(arg0, arg1 string) error {
+	ret := m.ctrl.Call(m, "Build", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Build indicates an expected call of Build
+func (mr *MockPNPMMockRecorder) Build(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Build", reflect.TypeOf((*MockPNPM)(nil).Build), arg0, arg1)
+}
+
+// Prune mocks base method
+func (m *MockPNPM) Prune(arg0, arg1 string) error {
+	ret := m.ctrl.Call(m, "Prune", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Prune indicates an expected call of Prune
+func (mr *MockPNPMMockRecorder) Prune(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockPNPM)(nil).Prune), arg0, arg1)
+}
+
 // MockStager is a mock of Stager interface
 type MockStager struct {
 	ctrl     *gomock.Controller
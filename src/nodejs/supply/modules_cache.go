@@ -0,0 +1,195 @@
+package supply
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type ModulesCacheState int
+
+const (
+	ModulesCacheMiss ModulesCacheState = iota
+	ModulesCacheHit
+	ModulesCacheRebuild
+)
+
+// modulesCacheKey describes the tree cached in cacheDir/node_modules. The
+// tree can be reused as is when every field matches; when only the node ABI
+// differs its native addons need a rebuild.
+type modulesCacheKey struct {
+	Lockfile string `json:"lockfile"`
+	ABI      string `json:"abi"`
+	Stack    string `json:"stack"`
+}
+
+func (s *Supplier) modulesCacheDir() string {
+	return filepath.Join(s.Stager.CacheDir(), "node_modules")
+}
+
+func (s *Supplier) modulesCacheKeyFile() string {
+	return filepath.Join(s.Stager.CacheDir(), "node_modules.json")
+}
+
+// RestoreModulesCache copies node_modules from the previous stage into the
+// app when it was built from the same package.json and lockfile. Only npm
+// installs of unvendored, single package apps are cached.
+func (s *Supplier) RestoreModulesCache() error {
+	s.ModulesCache = ModulesCacheMiss
+	s.modulesCacheKey = modulesCacheKey{}
+
+	if os.Getenv("NODE_MODULES_CACHE") == "false" {
+		s.Log.Info("NODE_MODULES_CACHE is false, not using cached node_modules")
+		s.Report.SetCache("node_modules", "disabled")
+		return s.clearModulesCache()
+	}
+	if s.PackageManager() != "npm" || s.IsVendored || s.Workspace != "" {
+		return nil
+	}
+	s.Report.SetCache("node_modules", "miss")
+
+	key, err := s.currentModulesCacheKey()
+	if err != nil {
+		return err
+	}
+	s.modulesCacheKey = key
+	if key.Lockfile == "" {
+		s.Log.Info("No package-lock.json or npm-shrinkwrap.json, not using cached node_modules")
+		return s.clearModulesCache()
+	}
+
+	var cached modulesCacheKey
+	if err := libbuildpack.NewJSON().Load(s.modulesCacheKeyFile(), &cached); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		s.Log.Warning("Discarding cached node_modules: %s", err.Error())
+		return s.clearModulesCache()
+	}
+
+	if found, err := libbuildpack.FileExists(s.modulesCacheDir()); err != nil {
+		return err
+	} else if !found {
+		return nil
+	}
+
+	switch {
+	case cached.Lockfile != key.Lockfile:
+		s.Log.Info("package.json or lockfile changed, discarding cached node_modules")
+		return s.clearModulesCache()
+	case cached.Stack != key.Stack:
+		s.Log.Info("Stack changed from %s to %s, discarding cached node_modules", cached.Stack, key.Stack)
+		return s.clearModulesCache()
+	case cached.ABI != key.ABI:
+		s.ModulesCache = ModulesCacheRebuild
+		s.Report.SetCache("node_modules", "stale abi")
+	default:
+		s.ModulesCache = ModulesCacheHit
+		s.Report.SetCache("node_modules", "hit")
+	}
+
+	s.Log.Info("Restoring node_modules from cache")
+	appNodeModules := filepath.Join(s.Stager.BuildDir(), "node_modules")
+	if err := os.MkdirAll(appNodeModules, 0755); err != nil {
+		return err
+	}
+	return libbuildpack.CopyDirectory(s.modulesCacheDir(), appNodeModules)
+}
+
+// SaveModulesCache stores the freshly built node_modules for the next stage,
+// under the key RestoreModulesCache computed before npm could rewrite the
+// lockfile.
+func (s *Supplier) SaveModulesCache() error {
+	key := s.modulesCacheKey
+	if key.Lockfile == "" {
+		return nil
+	}
+
+	appNodeModules := filepath.Join(s.Stager.BuildDir(), "node_modules")
+	if found, err := libbuildpack.FileExists(appNodeModules); err != nil {
+		return err
+	} else if !found {
+		return nil
+	}
+
+	if err := s.clearModulesCache(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.modulesCacheDir(), 0755); err != nil {
+		return err
+	}
+	if err := libbuildpack.CopyDirectory(appNodeModules, s.modulesCacheDir()); err != nil {
+		return err
+	}
+	return libbuildpack.NewJSON().Write(s.modulesCacheKeyFile(), key)
+}
+
+func (s *Supplier) clearModulesCache() error {
+	if err := os.RemoveAll(s.modulesCacheDir()); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.modulesCacheKeyFile())
+}
+
+// currentModulesCacheKey hashes package.json, the lockfile and the settings
+// that change which dependencies npm installs. Lockfile is empty when the
+// app has no lockfile, since the installed tree is then not reproducible.
+func (s *Supplier) currentModulesCacheKey() (modulesCacheKey, error) {
+	var key modulesCacheKey
+	buildDir := s.Stager.BuildDir()
+
+	hash := sha256.New()
+	lockfiles := 0
+	for _, name := range []string{"package.json", "package-lock.json", "npm-shrinkwrap.json"} {
+		contents, err := ioutil.ReadFile(filepath.Join(buildDir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return key, err
+		}
+		if name != "package.json" {
+			lockfiles++
+		}
+		hash.Write([]byte(name + "\x00"))
+		hash.Write(contents)
+	}
+	if lockfiles == 0 {
+		return key, nil
+	}
+	for _, envVar := range []string{"NODE_ENV", "NPM_CONFIG_PRODUCTION"} {
+		hash.Write([]byte(envVar + "=" + os.Getenv(envVar) + "\x00"))
+	}
+	// A tree cached for pruning holds the devDependencies as well.
+	if prune, err := s.pruneEnabled(); err != nil {
+		return key, err
+	} else if prune {
+		hash.Write([]byte("prune\x00"))
+	}
+	key.Lockfile = hex.EncodeToString(hash.Sum(nil))
+
+	abi, err := s.nodeABI()
+	if err != nil {
+		return key, err
+	}
+	key.ABI = abi
+	key.Stack = os.Getenv("CF_STACK")
+
+	return key, nil
+}
+
+// nodeABI returns the NODE_MODULE_VERSION of the installed node, which native
+// addons must be built for.
+func (s *Supplier) nodeABI() (string, error) {
+	buffer := new(bytes.Buffer)
+	if err := s.Command.Execute(s.Stager.BuildDir(), buffer, ioutil.Discard, "node", "-p", "process.versions.modules"); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buffer.String()), nil
+}
@@ -1,15 +1,32 @@
 package supply
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"nodejs/addons"
+	"nodejs/arch"
+	"nodejs/audit"
+	"nodejs/certs"
+	"nodejs/config"
+	"nodejs/diagnose"
+	"nodejs/inventory"
+	"nodejs/launch"
+	"nodejs/license"
+	"nodejs/registry"
+	"nodejs/report"
+	"nodejs/workspace"
+	"nodejs/yarn"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libbuildpack/checksum"
@@ -22,17 +39,33 @@ type Command interface {
 type Manifest interface {
 	AllDependencyVersions(string) []string
 	DefaultVersion(string) (libbuildpack.Dependency, error)
+	FetchDependency(libbuildpack.Dependency, string) error
 	InstallDependency(libbuildpack.Dependency, string) error
 	InstallOnlyVersion(string, string) error
+	RootDir() string
+}
+
+// Mirror is a node dist mirror to install versions the manifest lacks from.
+type Mirror interface {
+	Resolve(string) (string, error)
+	Install(string, string) error
+	String() string
 }
 
 type NPM interface {
 	Build(string, string) error
-	Rebuild(string) error
+	Rebuild(string, ...string) error
+	Prune(string, string) error
 }
 
 type Yarn interface {
 	Build(string, string) error
+	Prune(string, string) error
+}
+
+type PNPM interface {
+	Build(string, string) error
+	Prune(string, string) error
 }
 
 type Stager interface {
@@ -52,17 +85,34 @@ type Supplier struct {
 	Log                *libbuildpack.Logger
 	Logfile            *os.File
 	Command            Command
+	Config             config.Config
+	Report             *report.Report
+	Registry           *registry.Config
 	NodeVersion        string
+	NodeVersionSource  string
 	YarnVersion        string
 	NPMVersion         string
+	PNPMVersion        string
 	PreBuild           string
 	StartScript        string
 	HasDevDependencies bool
 	PostBuild          string
+	CFPreBuild         string
+	CFPostBuild        string
+	CFCleanup          string
+	BuildScript        string
 	UseYarn            bool
+	UseYarnBerry       bool
+	UsePNPM            bool
 	IsVendored         bool
+	ModulesCache       ModulesCacheState
+	Workspace          string
 	Yarn               Yarn
 	NPM                NPM
+	PNPM               PNPM
+	Mirror             Mirror
+
+	modulesCacheKey modulesCacheKey
 }
 
 type packageJSON struct {
@@ -73,12 +123,23 @@ type engines struct {
 	Node string `json:"node"`
 	Yarn string `json:"yarn"`
 	NPM  string `json:"npm"`
+	PNPM string `json:"pnpm"`
 	Iojs string `json:"iojs"`
 }
 
 func Run(s *Supplier) error {
-	return checksum.Do(s.Stager.BuildDir(), s.Log.Debug, func() error {
+	return checksum.Do(s.Stager.BuildDir(), s.Log.Debug, func() (err error) {
 		s.Log.BeginStep("Installing binaries")
+		if err := s.LoadConfig(); err != nil {
+			s.Log.Error("Unable to load buildpack.yml: %s", err.Error())
+			return err
+		}
+
+		if err := s.SelectWorkspace(); err != nil {
+			s.Log.Error("Unable to select workspace: %s", err.Error())
+			return err
+		}
+
 		if err := s.LoadPackageJSON(); err != nil {
 			s.Log.Error("Unable to load package.json: %s", err.Error())
 			return err
@@ -101,6 +162,11 @@ func Run(s *Supplier) error {
 			return err
 		}
 
+		if err := s.InstallPNPM(); err != nil {
+			s.Log.Error("Unable to install pnpm: %s", err.Error())
+			return err
+		}
+
 		if err := s.CreateDefaultEnv(); err != nil {
 			s.Log.Error("Unable to setup default environment: %s", err.Error())
 			return err
@@ -128,53 +194,87 @@ func Run(s *Supplier) error {
 			return err
 		}
 
+		if err := s.RestoreModulesCache(); err != nil {
+			s.Log.Error("Unable to restore cached node_modules: %s", err.Error())
+			return err
+		}
+
 		defer func() {
 			s.Logfile.Sync()
-			s.WarnUntrackedDependencies()
-			s.WarnMissingDevDeps()
+			s.Diagnose(err != nil)
 		}()
 
+		if err := s.ConfigureRegistries(); err != nil {
+			s.Log.Error("Unable to configure npm registries: %s", err.Error())
+			return err
+		}
+		defer s.Registry.Remove()
+
 		if err := s.BuildDependencies(); err != nil {
 			s.Log.Error("Unable to build dependencies: %s", err.Error())
 			return err
 		}
 
+		if err := s.SaveModulesCache(); err != nil {
+			s.Log.Error("Unable to cache node_modules: %s", err.Error())
+			return err
+		}
+
+		if err := s.PruneDevDependencies(); err != nil {
+			s.Log.Error("Unable to prune devDependencies: %s", err.Error())
+			return err
+		}
+
+		if err := s.Registry.Remove(); err != nil {
+			s.Log.Error("Unable to remove registry configuration: %s", err.Error())
+			return err
+		}
+
+		if err := s.RunCleanup(); err != nil {
+			s.Log.Error("Unable to clean up: %s", err.Error())
+			return err
+		}
+
 		if err := s.MoveDependencyArtifacts(); err != nil {
 			s.Log.Error("Unable to move dependencies: %s", err.Error())
 			return err
 		}
 
-		s.ListDependencies()
-
-		if err := s.Logfile.Sync(); err != nil {
-			s.Log.Error(err.Error())
+		if err := s.CheckLicenses(); err != nil {
+			s.Log.Error("License check failed: %s", err.Error())
 			return err
 		}
 
-		if err := s.WarnUnmetDependencies(); err != nil {
-			s.Log.Error(err.Error())
+		if err := s.Audit(); err != nil {
+			s.Log.Error("Audit failed: %s", err.Error())
 			return err
 		}
 
+		s.ListDependencies()
+
 		return nil
 	})
 }
 
-func (s *Supplier) WarnUnmetDependencies() error {
-	if unmet, err := fileHasString(s.Logfile.Name(), "unmet dependency", "unmet peer dependency"); err != nil {
+func (s *Supplier) LoadConfig() error {
+	var err error
+	s.Config, err = config.Load(s.Stager.BuildDir())
+	return err
+}
+
+// SelectWorkspace picks the workspace package staged as the app, if any.
+// Dependencies are still installed from the repo root.
+func (s *Supplier) SelectWorkspace() error {
+	ws, err := workspace.Selected(s.Stager.BuildDir(), s.Config.Workspace)
+	if err != nil {
 		return err
-	} else if !unmet {
-		return nil
 	}
 
-	pkgMan := "npm"
-	if s.UseYarn {
-		pkgMan = "yarn"
+	if ws.Dir != "" {
+		s.Log.Info("Staging workspace %s (%s)", ws.Dir, ws.Name)
 	}
+	s.Workspace = ws.Dir
 
-	warning := "Unmet dependencies don't fail " + pkgMan + " install but may cause runtime issues\n"
-	warning += "See: https://github.com/npm/npm/issues/7494"
-	s.Log.Warning(warning)
 	return nil
 }
 
@@ -183,19 +283,71 @@ func (s *Supplier) ListDependencies() {
 		return
 	}
 
-	if s.UseYarn {
-		_ = s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), ioutil.Discard, "yarn", "list", "--depth=0")
-	} else {
+	switch s.PackageManager() {
+	case "pnpm":
+		_ = s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), ioutil.Discard, "pnpm", "list", "--depth=0")
+	case "yarn":
+		if s.UseYarnBerry {
+			_ = s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), ioutil.Discard, "yarn", "info", "--name-only")
+		} else {
+			_ = s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), ioutil.Discard, "yarn", "list", "--depth=0")
+		}
+	default:
 		_ = s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), ioutil.Discard, "npm", "ls", "--depth=0")
 	}
 }
 
+// PackageManager returns the name of the tool used to install and run the
+// app's dependencies and scripts.
+func (s *Supplier) PackageManager() string {
+	if s.UsePNPM {
+		return "pnpm"
+	} else if s.UseYarn {
+		return "yarn"
+	}
+	return "npm"
+}
+
+// runPostbuild runs cloudfoundry-postbuild, or else heroku-postbuild. Apps
+// with neither get their build script run instead, unless buildpack.yml
+// lists build_scripts or NODE_RUN_BUILD is false.
 func (s *Supplier) runPostbuild(tool string) error {
-	if s.PostBuild == "" {
-		return nil
+	switch {
+	case s.CFPostBuild != "":
+		return s.runScript("cloudfoundry-postbuild", tool)
+	case s.PostBuild != "":
+		return s.runScript("heroku-postbuild", tool)
+	case s.BuildScript != "" && len(s.Config.BuildScripts) == 0:
+		if run, err := s.buildScriptEnabled(); err != nil || !run {
+			return err
+		}
+		return s.runScript("build", tool)
 	}
+	return nil
+}
 
-	return s.runScript("heroku-postbuild", tool)
+func (s *Supplier) buildScriptEnabled() (bool, error) {
+	if value := os.Getenv("NODE_RUN_BUILD"); value != "" {
+		run, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("NODE_RUN_BUILD must be true or false, not %s", value)
+		}
+		return run, nil
+	}
+	return s.Config.RunBuild == nil || *s.Config.RunBuild, nil
+}
+
+// pruneEnabled reads NODE_PRUNE_DEV_DEPENDENCIES, then
+// prune_dev_dependencies from buildpack.yml. Pruning is off by default.
+func (s *Supplier) pruneEnabled() (bool, error) {
+	if value := os.Getenv("NODE_PRUNE_DEV_DEPENDENCIES"); value != "" {
+		prune, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("NODE_PRUNE_DEV_DEPENDENCIES must be true or false, not %s", value)
+		}
+		return prune, nil
+	}
+	return s.Config.PruneDevDeps != nil && *s.Config.PruneDevDeps, nil
 }
 
 func (s *Supplier) runScript(script, tool string) error {
@@ -204,40 +356,113 @@ func (s *Supplier) runScript(script, tool string) error {
 		args = append(args, "--if-present")
 	}
 
+	return s.execScript(s.Stager.BuildDir(), script, tool, args...)
+}
+
+// execScript runs a package.json script, logging how long it took and how
+// it exited.
+func (s *Supplier) execScript(dir, script, tool string, args ...string) error {
 	s.Log.Info("Running %s (%s)", script, tool)
 
-	return s.Command.Execute(s.Stager.BuildDir(), os.Stdout, os.Stderr, tool, args...)
+	start := time.Now()
+	err := s.Command.Execute(dir, s.Log.Output(), s.Log.Output(), tool, args...)
+	elapsed := time.Since(start).Seconds()
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return fmt.Errorf("%s exited with code %d after %.1fs", script, status.ExitStatus(), elapsed)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed after %.1fs: %s", script, elapsed, err)
+	}
+
+	s.Log.Info("Finished %s in %.1fs", script, elapsed)
+	return nil
+}
 
+// runBuildScripts runs the build_scripts listed in buildpack.yml from the
+// app's directory, after all dependencies are installed.
+func (s *Supplier) runBuildScripts(tool string) error {
+	for _, script := range s.Config.BuildScripts {
+		if err := s.execScript(filepath.Join(s.Stager.BuildDir(), s.Workspace), script, tool, "run", script); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// runPrebuild runs cloudfoundry-prebuild, or else heroku-prebuild.
 func (s *Supplier) runPrebuild(tool string) error {
-	if s.PreBuild == "" {
-		return nil
+	switch {
+	case s.CFPreBuild != "":
+		return s.runScript("cloudfoundry-prebuild", tool)
+	case s.PreBuild != "":
+		return s.runScript("heroku-prebuild", tool)
 	}
+	return nil
+}
 
-	return s.runScript("heroku-prebuild", tool)
+// RunCleanup runs the cloudfoundry-cleanup script, once dependencies are
+// built and cached, to remove anything the droplet does not need.
+func (s *Supplier) RunCleanup() error {
+	if s.CFCleanup == "" {
+		return nil
+	}
+	return s.runScript("cloudfoundry-cleanup", s.PackageManager())
 }
 
 func (s *Supplier) BuildDependencies() error {
-	var tool string
-	if s.UseYarn {
-		tool = "yarn"
-	} else {
-		tool = "npm"
-	}
+	tool := s.PackageManager()
 
 	s.Log.BeginStep("Building dependencies")
+	s.Report.SetPackageManager(tool)
 
 	if err := s.runPrebuild(tool); err != nil {
 		return err
 	}
 
-	if s.UseYarn {
+	// devDependencies are pruned after the build scripts, so install them
+	// whatever NPM_CONFIG_PRODUCTION says. npm 7+ only honours --include.
+	if prune, err := s.pruneEnabled(); err != nil {
+		return err
+	} else if prune {
+		s.Log.Info("Installing devDependencies for the build, they are pruned afterwards")
+		for envVar, value := range map[string]string{"NPM_CONFIG_PRODUCTION": "false", "NPM_CONFIG_INCLUDE": "dev"} {
+			previous, found := os.LookupEnv(envVar)
+			if err := os.Setenv(envVar, value); err != nil {
+				return err
+			}
+			if found {
+				defer os.Setenv(envVar, previous)
+			} else {
+				defer os.Unsetenv(envVar)
+			}
+		}
+	}
+
+	if s.UsePNPM {
+		s.Report.SetInstallMode("install")
+		if err := s.PNPM.Build(s.Stager.BuildDir(), s.Stager.CacheDir()); err != nil {
+			return err
+		}
+	} else if s.UseYarn {
+		s.Report.SetInstallMode("install")
 		if err := s.Yarn.Build(s.Stager.BuildDir(), s.Stager.CacheDir()); err != nil {
 			return err
 		}
 	} else if s.IsVendored {
 		s.Log.Info("Prebuild detected (node_modules already exists)")
+		s.Report.SetInstallMode("vendored")
+		if err := s.rebuildVendored(); err != nil {
+			return err
+		}
+	} else if s.ModulesCache == ModulesCacheHit {
+		s.Log.Info("Cached node_modules match package.json and the lockfile, skipping npm install")
+		s.Report.SetInstallMode("cached")
+	} else if s.ModulesCache == ModulesCacheRebuild {
+		s.Log.Info("Node ABI changed since node_modules was cached")
+		s.Report.SetInstallMode("rebuild")
 		if err := s.NPM.Rebuild(s.Stager.BuildDir()); err != nil {
 			return err
 		}
@@ -251,45 +476,346 @@ func (s *Supplier) BuildDependencies() error {
 		return err
 	}
 
+	if err := s.runBuildScripts(tool); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// rebuildVendored rebuilds vendored node_modules. When it holds native
+// addons that cannot load here, such as ones built on a Mac or for another
+// node, only their packages are rebuilt, and staging fails if that does not
+// fix them rather than leaving the app to crash when it requires them.
+func (s *Supplier) rebuildVendored() error {
+	buildDir := s.Stager.BuildDir()
+	goarch := arch.Current()
+
+	found, err := addons.Scan(buildDir, goarch, "")
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return s.NPM.Rebuild(buildDir)
+	}
+
+	abi, err := s.nodeABI()
+	if err != nil {
+		return err
+	}
+	incompatible, err := incompatibleAddons(buildDir, goarch, abi)
+	if err != nil {
+		return err
+	}
+	if len(incompatible) == 0 {
+		return s.NPM.Rebuild(buildDir)
+	}
+
+	s.Log.Warning("These native modules in node_modules cannot load on linux/%s with NODE_MODULE_VERSION %s:\n%s", goarch, abi, addons.Table(incompatible, goarch, abi))
+
+	var packages []string
+	seen := map[string]bool{}
+	for _, addon := range incompatible {
+		if addon.Package != "" && !seen[addon.Package] {
+			seen[addon.Package] = true
+			packages = append(packages, addon.Package)
+		}
+	}
+	if err := s.NPM.Rebuild(buildDir, packages...); err != nil {
+		return err
+	}
+
+	if incompatible, err = incompatibleAddons(buildDir, goarch, abi); err != nil {
+		return err
+	}
+	if len(incompatible) > 0 {
+		s.Log.Error("Rebuilding did not fix these native modules:\n%s", addons.Table(incompatible, goarch, abi))
+		s.Log.Error("Add node_modules to .cfignore, so dependencies are installed on the stack, or vendor node_modules built on the same stack")
+		return errors.New("vendored node_modules contains native modules that cannot load")
+	}
+	return nil
+}
+
+func incompatibleAddons(buildDir, goarch, abi string) ([]addons.Addon, error) {
+	found, err := addons.Scan(buildDir, goarch, abi)
+	if err != nil {
+		return nil, err
+	}
+
+	var incompatible []addons.Addon
+	for _, addon := range found {
+		if addon.Problem(goarch, abi) != "" {
+			incompatible = append(incompatible, addon)
+		}
+	}
+	return incompatible, nil
+}
+
+// PruneDevDependencies removes the devDependencies BuildDependencies
+// installed for the build scripts, after node_modules is cached with them,
+// and logs how much it removed.
+func (s *Supplier) PruneDevDependencies() error {
+	if prune, err := s.pruneEnabled(); err != nil || !prune {
+		return err
+	}
+	if s.IsVendored && !s.UseYarn && !s.UsePNPM {
+		s.Log.Info("Not pruning vendored node_modules")
+		return nil
+	}
+
+	s.Log.BeginStep("Pruning devDependencies")
+
+	dirs := []string{filepath.Join(s.Stager.BuildDir(), "node_modules")}
+	if s.Workspace != "" {
+		dirs = append(dirs, filepath.Join(s.Stager.BuildDir(), s.Workspace, "node_modules"))
+	}
+	packagesBefore, bytesBefore, err := measure(dirs)
+	if err != nil {
+		return err
+	}
+
+	if s.UsePNPM {
+		err = s.PNPM.Prune(s.Stager.BuildDir(), s.Stager.CacheDir())
+	} else if s.UseYarn {
+		err = s.Yarn.Prune(s.Stager.BuildDir(), s.Stager.CacheDir())
+	} else {
+		err = s.NPM.Prune(s.Stager.BuildDir(), s.Stager.CacheDir())
+	}
+	if err != nil {
+		return err
+	}
+
+	packagesAfter, bytesAfter, err := measure(dirs)
+	if err != nil {
+		return err
+	}
+	s.Log.Info("Removed %d packages (%s), %d packages (%s) remain", packagesBefore-packagesAfter, formatBytes(bytesBefore-bytesAfter), packagesAfter, formatBytes(bytesAfter))
+	return nil
+}
+
+// measure counts the packages in nodeModulesDirs and the bytes they take,
+// without following symlinks.
+func measure(nodeModulesDirs []string) (int, int64, error) {
+	packages, err := inventory.Installed(nodeModulesDirs...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var size int64
+	for _, dir := range nodeModulesDirs {
+		err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				size += info.Size()
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return 0, 0, err
+		}
+	}
+	return len(packages), size, nil
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func (s *Supplier) MoveDependencyArtifacts() error {
 	if s.IsVendored {
 		return nil
 	}
 
+	if s.UseYarn {
+		if pnpFile, err := yarn.PnPFile(s.Stager.BuildDir()); err != nil {
+			return err
+		} else if pnpFile != "" {
+			s.Log.Info("Yarn Plug'n'Play detected (%s), leaving dependencies in place", pnpFile)
+			return s.Stager.WriteProfileD("yarn-pnp.sh", fmt.Sprintf("export NODE_OPTIONS=\"--require $HOME/%s${NODE_OPTIONS:+ $NODE_OPTIONS}\"\n", pnpFile))
+		}
+	}
+
+	moved := map[string]string{}
+	var nodePaths []string
+
+	if s.Workspace != "" {
+		workspaceNodeModules := filepath.Join(s.Stager.BuildDir(), s.Workspace, "node_modules")
+		workspaceNodePath := filepath.Join(s.Stager.DepDir(), "workspace", "node_modules")
+		if found, err := moveDir(workspaceNodeModules, workspaceNodePath); err != nil {
+			return err
+		} else if found {
+			moved[workspaceNodeModules] = workspaceNodePath
+			nodePaths = append(nodePaths, workspaceNodePath)
+
+			if err := s.writeWorkspaceProfileD(); err != nil {
+				return err
+			}
+		}
+	}
+
 	appNodeModules := filepath.Join(s.Stager.BuildDir(), "node_modules")
+	nodePath := filepath.Join(s.Stager.DepDir(), "node_modules")
+	if found, err := moveDir(appNodeModules, nodePath); err != nil {
+		return err
+	} else if found {
+		moved[appNodeModules] = nodePath
+		nodePaths = append(nodePaths, nodePath)
+	}
+
+	if len(moved) == 0 {
+		return nil
+	}
+
+	if err := retargetSymlinks(moved); err != nil {
+		return err
+	}
+
+	if err := s.Stager.WriteEnvFile("NODE_PATH", strings.Join(nodePaths, ":")); err != nil {
+		return err
+	}
+
+	return os.Setenv("NODE_PATH", strings.Join(nodePaths, ":"))
+}
 
-	_, err := os.Stat(appNodeModules)
+// ConfigureRegistries writes the registry configuration the package managers
+// install from, when registries are bound or set in the environment.
+func (s *Supplier) ConfigureRegistries() error {
+	registries, err := registry.Load()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
+	for _, r := range registries {
+		s.Log.Info("Using npm registry %s", r)
+	}
+	return s.Registry.Write(registries)
+}
 
-	nodePath := filepath.Join(s.Stager.DepDir(), "node_modules")
+// CheckLicenses holds every installed package to the license policy, if one
+// is configured.
+func (s *Supplier) CheckLicenses() error {
+	policy, err := license.NewPolicy(s.Config.LicensePolicy)
+	if err != nil {
+		return err
+	} else if policy.Empty() {
+		return nil
+	}
 
-	if err := os.Rename(appNodeModules, nodePath); err != nil {
+	s.Log.BeginStep("Checking dependency licenses")
+	packages, err := inventory.Installed(inventory.NodeModulesDirs(s.Stager.BuildDir(), s.Stager.DepDir(), s.Workspace)...)
+	if err != nil {
 		return err
 	}
 
-	if err := s.Stager.WriteEnvFile("NODE_PATH", nodePath); err != nil {
+	violations, err := policy.Check(filepath.Join(s.Stager.BuildDir(), s.Workspace), packages)
+	if err != nil {
 		return err
 	}
+	if len(violations) == 0 {
+		s.Log.Info("All %d packages comply with the license policy", len(packages))
+		return nil
+	}
 
-	return os.Setenv("NODE_PATH", nodePath)
+	message := fmt.Sprintf("%d packages violate the license policy:\n%s", len(violations), license.Table(violations))
+	if policy.Action == "warn" {
+		s.Log.Warning("%s", message)
+		return nil
+	}
+	return errors.New(message)
+}
+
+// Audit matches the dependency tree against the advisory databases found,
+// if any, and fails on findings at or above the configured severity.
+func (s *Supplier) Audit() error {
+	policy, err := audit.NewPolicy(s.Config.Audit)
+	if err != nil {
+		return err
+	}
+
+	db, err := audit.Load(s.Manifest.RootDir(), filepath.Dir(s.Stager.DepDir()))
+	if err != nil {
+		return err
+	} else if len(db.Sources) == 0 {
+		s.Log.Debug("No advisory database found, skipping audit")
+		return nil
+	}
+
+	s.Log.BeginStep("Auditing dependencies against %d advisories", len(db.Advisories))
+	s.Log.Debug("Advisories from %s", strings.Join(db.Sources, ", "))
+	packages, err := inventory.Inventory(s.Stager.BuildDir(), inventory.NodeModulesDirs(s.Stager.BuildDir(), s.Stager.DepDir(), s.Workspace)...)
+	if err != nil {
+		return err
+	}
+
+	var findings, failing []audit.Finding
+	for _, finding := range db.Check(packages) {
+		if policy.Ignores(finding) {
+			s.Log.Info("Ignoring %s in %s", finding.Advisory.ID, finding.Package.ID())
+			continue
+		}
+		findings = append(findings, finding)
+		if policy.Fails(finding) {
+			failing = append(failing, finding)
+		}
+	}
+
+	if len(findings) == 0 {
+		s.Log.Info("No known vulnerabilities in %d packages", len(packages))
+		return nil
+	}
+
+	message := fmt.Sprintf("%d known vulnerabilities in dependencies:\n%s", len(findings), audit.Table(findings))
+	if len(failing) == 0 {
+		s.Log.Warning("%s", message)
+		return nil
+	}
+	return fmt.Errorf("%s\n%d at or above %s severity; fix them, or set NODE_AUDIT_IGNORE or NODE_AUDIT_LEVEL", message, len(failing), policy.Level)
+}
+
+// writeWorkspaceProfileD links the workspace's own node_modules back into
+// the app at runtime, the way node.sh does for the hoisted ones.
+func (s *Supplier) writeWorkspaceProfileD() error {
+	workspaceNodePath := filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "workspace", "node_modules")
+	appWorkspaceNodeModules := filepath.Join("$HOME", s.Workspace, "node_modules")
+
+	scriptContents := `if [ ! -d "%[2]s" ]; then
+	ln -s "%[1]s" "%[2]s"
+fi
+export NODE_PATH="%[1]s${NODE_PATH:+:$NODE_PATH}"
+export PATH=$PATH:"%[1]s/.bin"
+`
+	return s.Stager.WriteProfileD("workspace.sh", fmt.Sprintf(scriptContents, workspaceNodePath, appWorkspaceNodeModules))
+}
+
+func moveDir(from, to string) (bool, error) {
+	if _, err := os.Stat(from); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return false, err
+	}
+
+	return true, os.Rename(from, to)
 }
 
 func (s *Supplier) ReadPackageJSON() error {
 	var err error
 	var p struct {
-		Scripts struct {
-			PreBuild    string `json:"heroku-prebuild"`
-			PostBuild   string `json:"heroku-postbuild"`
-			StartScript string `json:"start"`
-		} `json:"scripts"`
+		Scripts         map[string]string `json:"scripts"`
 		DevDependencies map[string]string `json:"devDependencies"`
 	}
 
@@ -297,6 +823,15 @@ func (s *Supplier) ReadPackageJSON() error {
 		return err
 	}
 
+	if s.UsePNPM, err = libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), "pnpm-lock.yaml")); err != nil {
+		return err
+	}
+
+	if s.UsePNPM && s.UseYarn {
+		s.Log.Warning("Both pnpm-lock.yaml and yarn.lock found, using pnpm")
+		s.UseYarn = false
+	}
+
 	if s.IsVendored, err = libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), "node_modules")); err != nil {
 		return err
 	}
@@ -311,14 +846,52 @@ func (s *Supplier) ReadPackageJSON() error {
 	}
 
 	s.HasDevDependencies = (len(p.DevDependencies) > 0)
-	s.PreBuild = p.Scripts.PreBuild
-	s.PostBuild = p.Scripts.PostBuild
-	s.StartScript = p.Scripts.StartScript
+	s.PreBuild = p.Scripts["heroku-prebuild"]
+	s.PostBuild = p.Scripts["heroku-postbuild"]
+	s.CFPreBuild = p.Scripts["cloudfoundry-prebuild"]
+	s.CFPostBuild = p.Scripts["cloudfoundry-postbuild"]
+	s.CFCleanup = p.Scripts["cloudfoundry-cleanup"]
+	s.BuildScript = p.Scripts["build"]
+	s.StartScript = p.Scripts["start"]
+
+	if s.Workspace != "" {
+		var w struct {
+			Scripts struct {
+				StartScript string `json:"start"`
+			} `json:"scripts"`
+			DevDependencies map[string]string `json:"devDependencies"`
+		}
+		if err := libbuildpack.NewJSON().Load(filepath.Join(s.Stager.BuildDir(), s.Workspace, "package.json"), &w); err != nil {
+			return err
+		}
+
+		s.HasDevDependencies = s.HasDevDependencies || len(w.DevDependencies) > 0
+		s.StartScript = w.Scripts.StartScript
+	}
+
+	if len(s.Config.BuildScripts) > 0 {
+		var app struct {
+			Scripts map[string]string `json:"scripts"`
+		}
+		if err := libbuildpack.NewJSON().Load(filepath.Join(s.Stager.BuildDir(), s.Workspace, "package.json"), &app); err != nil {
+			return err
+		}
+
+		for _, script := range s.Config.BuildScripts {
+			if _, found := app.Scripts[script]; !found {
+				return fmt.Errorf("buildpack.yml lists build script %s, but package.json has no such script", script)
+			}
+		}
+	}
 
 	return nil
 }
 
 func (s *Supplier) TipVendorDependencies() error {
+	if s.UseYarnBerry {
+		return nil
+	}
+
 	subdirs, err := hasSubdirs(filepath.Join(s.Stager.BuildDir(), "node_modules"))
 	if err != nil {
 		return err
@@ -373,58 +946,34 @@ func (s *Supplier) ListNodeConfig(environment []string) {
 	}
 }
 
-func (s *Supplier) WarnUntrackedDependencies() error {
-	for _, command := range []string{"grunt", "bower", "gulp"} {
-		if notFound, err := fileHasString(s.Logfile.Name(), command+": not found", command+": command not found"); err != nil {
-			return err
-		} else if notFound {
-			s.Log.Warning(strings.Title(command) + " may not be tracked in package.json")
-		}
-	}
-
-	return nil
-}
-
-func (s *Supplier) WarnMissingDevDeps() error {
-	if noModule, err := fileHasString(s.Logfile.Name(), "cannot find module"); err != nil {
+// Diagnose explains the failures the diagnostic rules recognise in the
+// staging log. When staging has not failed, only the rules marked Always
+// are reported.
+func (s *Supplier) Diagnose(failed bool) error {
+	rules, err := diagnose.Load(s.Manifest.RootDir(), filepath.Dir(s.Stager.DepDir()))
+	if err != nil {
 		return err
-	} else if !noModule {
-		return nil
 	}
-
-	warning := "A module may be missing from 'dependencies' in package.json"
-
-	if os.Getenv("NPM_CONFIG_PRODUCTION") == "true" && s.HasDevDependencies {
-		warning += "\nThis module may be specified in 'devDependencies' instead of 'dependencies'\n"
-		warning += "See: https://devcenter.heroku.com/articles/nodejs-support#devdependencies"
+	facts := diagnose.Facts{
+		"package_manager":          s.PackageManager(),
+		"dev_dependencies_omitted": strconv.FormatBool(os.Getenv("NPM_CONFIG_PRODUCTION") == "true" && s.HasDevDependencies),
 	}
-
-	s.Log.Warning(warning)
-	return nil
-}
-
-func fileHasString(file string, patterns ...string) (bool, error) {
-	f, err := os.Open(file)
+	findings, err := diagnose.Analyze(s.Logfile.Name(), rules, facts)
 	if err != nil {
-		return false, err
+		return err
 	}
-	defer f.Close()
-	reader := bufio.NewReader(f)
-	line, err := reader.ReadString('\n')
-	for err == nil {
-		src := strings.ToLower(line)
-		for _, pat := range patterns {
-			if strings.Contains(src, pat) {
-				return true, nil
-			}
+
+	for _, finding := range findings {
+		if !failed && !finding.Rule.Always {
+			continue
 		}
-		line, err = reader.ReadString('\n')
-	}
-	if err != io.EOF {
-		return false, err
+		warning := finding.Message
+		if finding.Rule.Link != "" {
+			warning += "\nSee: " + finding.Rule.Link
+		}
+		s.Log.Warning("%s", warning)
 	}
-
-	return false, nil
+	return nil
 }
 
 func (s *Supplier) LoadPackageJSON() error {
@@ -435,6 +984,14 @@ func (s *Supplier) LoadPackageJSON() error {
 		return err
 	}
 
+	// Loading the workspace's package.json over the root's lets its engines
+	// win while keeping any the root sets that it leaves out.
+	if s.Workspace != "" {
+		if err := libbuildpack.NewJSON().Load(filepath.Join(s.Stager.BuildDir(), s.Workspace, "package.json"), &p); err != nil {
+			return err
+		}
+	}
+
 	if p.Engines.Iojs != "" {
 		return errors.New("io.js not supported by this buildpack")
 	}
@@ -451,36 +1008,177 @@ func (s *Supplier) LoadPackageJSON() error {
 		s.Log.Info("engines.npm (package.json): unspecified (use default)")
 	}
 
-	s.NodeVersion = p.Engines.Node
-	s.NPMVersion = p.Engines.NPM
-	s.YarnVersion = p.Engines.Yarn
+	s.NodeVersion = s.configuredVersion("version", s.Config.Version, "node", p.Engines.Node)
+	if s.Config.Version != "" {
+		s.NodeVersionSource = "buildpack.yml"
+	} else if p.Engines.Node != "" {
+		s.NodeVersionSource = "package.json"
+	} else if s.NodeVersion, s.NodeVersionSource, err = s.nodeVersionFromFiles(); err != nil {
+		return err
+	}
+
+	if s.NodeVersion != "" {
+		s.Log.Info("Using node version %s from %s", s.NodeVersion, s.NodeVersionSource)
+	} else {
+		s.Log.Info("No node version in buildpack.yml, package.json, .nvmrc or .node-version, using the buildpack default")
+	}
+
+	s.NPMVersion = s.configuredVersion("npm_version", s.Config.NPMVersion, "npm", p.Engines.NPM)
+	s.YarnVersion = s.configuredVersion("yarn_version", s.Config.YarnVersion, "yarn", p.Engines.Yarn)
+	s.PNPMVersion = s.configuredVersion("pnpm_version", s.Config.PNPMVersion, "pnpm", p.Engines.PNPM)
+
+	if s.UseYarnBerry, err = yarn.IsBerry(s.Stager.BuildDir()); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// configuredVersion applies a version from buildpack.yml, which takes
+// precedence over the matching engines entry in package.json.
+func (s *Supplier) configuredVersion(key, configured, engine, fromPackageJSON string) string {
+	if configured == "" {
+		return fromPackageJSON
+	}
+
+	if fromPackageJSON != "" && fromPackageJSON != configured {
+		s.Log.Warning("nodejs.%s (buildpack.yml): %s overrides engines.%s (package.json): %s", key, configured, engine, fromPackageJSON)
+	} else {
+		s.Log.Info("nodejs.%s (buildpack.yml): %s", key, configured)
+	}
+	return configured
+}
+
+var nodeLTSCodenames = map[string]int{
+	"argon":    4,
+	"boron":    6,
+	"carbon":   8,
+	"dubnium":  10,
+	"erbium":   12,
+	"fermium":  14,
+	"gallium":  16,
+	"hydrogen": 18,
+	"iron":     20,
+	"jod":      22,
+}
+
+var partialVersion = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+// nodeVersionFromFiles reads the version pinned for nvm and similar tools,
+// looking in the workspace before the repo root. It returns the version and
+// the file it came from.
+func (s *Supplier) nodeVersionFromFiles() (string, string, error) {
+	dirs := []string{s.Stager.BuildDir()}
+	if s.Workspace != "" {
+		dirs = append([]string{filepath.Join(s.Stager.BuildDir(), s.Workspace)}, dirs...)
+	}
+
+	for _, dir := range dirs {
+		for _, name := range []string{".nvmrc", ".node-version"} {
+			contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return "", "", err
+			}
+
+			version := strings.ToLower(strings.TrimSpace(strings.SplitN(string(contents), "\n", 2)[0]))
+			if version == "" {
+				continue
+			}
+
+			// nvm reads "v8.11" or "10" as the newest matching release.
+			if len(version) > 1 && version[0] == 'v' && version[1] >= '0' && version[1] <= '9' {
+				version = version[1:]
+			}
+			if partialVersion.MatchString(version) {
+				version += ".x"
+			}
+
+			source, err := filepath.Rel(s.Stager.BuildDir(), filepath.Join(dir, name))
+			if err != nil {
+				return "", "", err
+			}
+			return version, source, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// nodeVersionRange turns the nvm aliases node, stable, lts/* and
+// lts/<codename> into a range the manifest can be searched with. lts/*
+// picks the newest even major, which assumes the manifest only carries
+// even majors once they have entered LTS.
+func nodeVersionRange(version string, versions []string) (string, error) {
+	switch {
+	case version == "node" || version == "stable" || version == "current" || version == "latest":
+		return "*", nil
+	case version == "lts/*":
+		newest := -1
+		for _, v := range versions {
+			major, err := strconv.Atoi(strings.SplitN(v, ".", 2)[0])
+			if err == nil && major >= 4 && major%2 == 0 && major > newest {
+				newest = major
+			}
+		}
+		if newest < 0 {
+			return "", fmt.Errorf("%s requested, but the buildpack has no LTS release of node", version)
+		}
+		return fmt.Sprintf("%d.x", newest), nil
+	case strings.HasPrefix(version, "lts/"):
+		major, found := nodeLTSCodenames[strings.TrimPrefix(version, "lts/")]
+		if !found {
+			return "", fmt.Errorf("unknown node LTS line %s", version)
+		}
+		return fmt.Sprintf("%d.x", major), nil
+	}
+	return version, nil
+}
+
 func (s *Supplier) WarnNodeEngine() {
 	docsLink := "http://docs.cloudfoundry.org/buildpacks/node/node-tips.html"
 
+	source := "engines.node"
+	if s.NodeVersionSource != "" && s.NodeVersionSource != "package.json" {
+		source = s.NodeVersionSource
+	}
+
 	if s.NodeVersion == "" {
-		s.Log.Warning("Node version not specified in package.json. See: %s", docsLink)
+		s.Log.Warning("Node version not specified in buildpack.yml, package.json, .nvmrc or .node-version. See: %s", docsLink)
 	}
 	if s.NodeVersion == "*" {
-		s.Log.Warning("Dangerous semver range (*) in engines.node. See: %s", docsLink)
+		s.Log.Warning("Dangerous semver range (*) in %s. See: %s", source, docsLink)
 	}
 	if strings.HasPrefix(s.NodeVersion, ">") {
-		s.Log.Warning("Dangerous semver range (>) in engines.node. See: %s", docsLink)
+		s.Log.Warning("Dangerous semver range (>) in %s. See: %s", source, docsLink)
 	}
 	return
 }
 
 func (s *Supplier) InstallNode(tempDir string) error {
 	var dep libbuildpack.Dependency
+	var fromMirror bool
 
 	nodeInstallDir := filepath.Join(s.Stager.DepDir(), "node")
 
 	if s.NodeVersion != "" {
 		versions := s.Manifest.AllDependencyVersions("node")
-		ver, err := libbuildpack.FindMatchingVersion(s.NodeVersion, versions)
+		versionRange, err := nodeVersionRange(s.NodeVersion, versions)
+		if err != nil {
+			return err
+		}
+		if versionRange != s.NodeVersion {
+			s.Log.Info("Resolved node version %s to %s", s.NodeVersion, versionRange)
+		}
+
+		ver, err := libbuildpack.FindMatchingVersion(versionRange, versions)
+		if err != nil && s.Mirror != nil {
+			s.Log.Info("No node version matching %s in the buildpack manifest, looking in %s", versionRange, s.Mirror)
+			if ver, err = s.Mirror.Resolve(versionRange); err == nil {
+				fromMirror = true
+			}
+		}
 		if err != nil {
 			return err
 		}
@@ -495,11 +1193,30 @@ func (s *Supplier) InstallNode(tempDir string) error {
 		}
 	}
 
-	if err := s.Manifest.InstallDependency(dep, tempDir); err != nil {
+	if fromMirror {
+		s.Log.BeginStep("Installing node %s from %s", dep.Version, s.Mirror)
+		s.Log.Warning("node %s is not in the buildpack manifest, it was downloaded from the node_dist_mirror in manifest.yml and verified against its SHASUMS256.txt only", dep.Version)
+		if err := s.Mirror.Install(dep.Version, tempDir); err != nil {
+			return err
+		}
+	} else if err := s.Manifest.InstallDependency(dep, tempDir); err != nil {
 		return err
 	}
 
-	if err := os.Rename(filepath.Join(tempDir, fmt.Sprintf("node-v%s-linux-x64", dep.Version)), nodeInstallDir); err != nil {
+	source := s.NodeVersionSource
+	if source == "" {
+		source = "default"
+	}
+	s.Report.SetTool("node", s.NodeVersion, dep.Version, source)
+
+	// The dist is named for its architecture, node-v<version>-linux-<arch>.
+	dists, err := filepath.Glob(filepath.Join(tempDir, fmt.Sprintf("node-v%s-linux-*", dep.Version)))
+	if err != nil {
+		return err
+	} else if len(dists) != 1 {
+		return fmt.Errorf("expected one node-v%s-linux-* directory in the node archive, found %d", dep.Version, len(dists))
+	}
+	if err := os.Rename(dists[0], nodeInstallDir); err != nil {
 		return err
 	}
 
@@ -517,15 +1234,18 @@ func (s *Supplier) InstallNPM() error {
 	}
 
 	npmVersion := strings.TrimSpace(buffer.String())
+	source := s.versionSource(s.Config.NPMVersion, s.NPMVersion)
 
 	if s.NPMVersion == "" {
 		s.Log.Info("Using default npm version: %s", npmVersion)
+		s.Report.SetTool("npm", "", npmVersion, source)
 		return nil
 	}
 
 	_, err := libbuildpack.FindMatchingVersion(s.NPMVersion, []string{npmVersion})
 	if err == nil {
 		s.Log.Info("npm %s already installed with node", npmVersion)
+		s.Report.SetTool("npm", s.NPMVersion, npmVersion, source)
 		return nil
 	}
 
@@ -535,15 +1255,42 @@ func (s *Supplier) InstallNPM() error {
 		s.Log.Error("We're unable to download the version of npm you've provided (%s).\nPlease remove the npm version specification in package.json", s.NPMVersion)
 		return err
 	}
+
+	buffer.Reset()
+	if err := s.Command.Execute(s.Stager.BuildDir(), buffer, buffer, "npm", "--version"); err != nil {
+		return err
+	}
+	s.Report.SetTool("npm", s.NPMVersion, strings.TrimSpace(buffer.String()), source)
+
 	return nil
 }
 
+// versionSource names where a requested tool version came from.
+func (s *Supplier) versionSource(configured, requested string) string {
+	if configured != "" {
+		return "buildpack.yml"
+	} else if requested != "" {
+		return "package.json"
+	}
+	return "default"
+}
+
 func (s *Supplier) InstallYarn() error {
-	if s.YarnVersion != "" {
+	if s.UseYarnBerry {
+		yarnPath, err := yarn.YarnPath(s.Stager.BuildDir())
+		if err != nil {
+			return err
+		} else if yarnPath == "" {
+			return s.installYarnWithCorepack()
+		}
+		// The yarn 1.x in the manifest only bootstraps the release checked
+		// in at yarnPath, so engines.yarn is not matched against it.
+		s.Log.Info("Yarn Berry detected, using the release at %s", yarnPath)
+	} else if s.YarnVersion != "" {
 		versions := s.Manifest.AllDependencyVersions("yarn")
 		_, err := libbuildpack.FindMatchingVersion(s.YarnVersion, versions)
 		if err != nil {
-			return fmt.Errorf("package.json requested %s, buildpack only includes yarn version %s", s.YarnVersion, strings.Join(versions, ", "))
+			return fmt.Errorf("%s requested %s, buildpack only includes yarn version %s", s.versionSource(s.Config.YarnVersion, s.YarnVersion), s.YarnVersion, strings.Join(versions, ", "))
 		}
 	}
 
@@ -572,6 +1319,93 @@ func (s *Supplier) InstallYarn() error {
 
 	yarnVersion := strings.TrimSpace(buffer.String())
 	s.Log.Info("Installed yarn %s", yarnVersion)
+	s.Report.SetTool("yarn", s.YarnVersion, yarnVersion, s.versionSource(s.Config.YarnVersion, s.YarnVersion))
+
+	return nil
+}
+
+func (s *Supplier) installYarnWithCorepack() error {
+	if err := s.Command.Execute(s.Stager.BuildDir(), ioutil.Discard, ioutil.Discard, "corepack", "--version"); err != nil {
+		return errors.New("Yarn Berry apps need yarnPath set in .yarnrc.yml, or a node version that ships corepack")
+	}
+
+	binDir := filepath.Join(s.Stager.DepDir(), "bin")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return err
+	}
+
+	s.Log.Info("Yarn Berry detected, enabling yarn with corepack")
+	if err := s.Command.Execute(s.Stager.BuildDir(), s.Log.Output(), s.Log.Output(), "corepack", "enable", "--install-directory", binDir, "yarn"); err != nil {
+		return err
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := s.Command.Execute(s.Stager.BuildDir(), buffer, buffer, "yarn", "--version"); err != nil {
+		return err
+	}
+
+	s.Log.Info("Installed yarn %s", strings.TrimSpace(buffer.String()))
+	s.Report.SetTool("yarn", s.YarnVersion, strings.TrimSpace(buffer.String()), "corepack")
+
+	return nil
+}
+
+// InstallPNPM installs pnpm globally with the bundled npm. The version comes
+// from engines.pnpm, matched against the pnpm entries in the manifest so that
+// cached buildpacks that include pnpm stage offline; when the manifest has
+// none, pnpm is fetched from the npm registry instead.
+func (s *Supplier) InstallPNPM() error {
+	if found, err := libbuildpack.FileExists(filepath.Join(s.Stager.BuildDir(), "pnpm-lock.yaml")); err != nil {
+		return err
+	} else if !found {
+		return nil
+	}
+
+	pkg := "pnpm@latest"
+	if s.PNPMVersion != "" {
+		pkg = "pnpm@" + s.PNPMVersion
+	}
+
+	if versions := s.Manifest.AllDependencyVersions("pnpm"); len(versions) > 0 {
+		dep := libbuildpack.Dependency{Name: "pnpm"}
+		if s.PNPMVersion != "" {
+			ver, err := libbuildpack.FindMatchingVersion(s.PNPMVersion, versions)
+			if err != nil {
+				return fmt.Errorf("%s requested %s, buildpack only includes pnpm version %s", s.versionSource(s.Config.PNPMVersion, s.PNPMVersion), s.PNPMVersion, strings.Join(versions, ", "))
+			}
+			dep.Version = ver
+		} else {
+			var err error
+			if dep, err = s.Manifest.DefaultVersion("pnpm"); err != nil {
+				return err
+			}
+		}
+
+		tarball := filepath.Join(os.TempDir(), fmt.Sprintf("pnpm-%s.tgz", dep.Version))
+		if err := s.Manifest.FetchDependency(dep, tarball); err != nil {
+			return err
+		}
+		defer os.Remove(tarball)
+		pkg = tarball
+	} else {
+		s.Log.Info("No pnpm in the buildpack manifest, installing %s from the npm registry", pkg)
+	}
+
+	if err := s.Command.Execute(s.Stager.BuildDir(), ioutil.Discard, ioutil.Discard, "npm", "install", "--unsafe-perm", "--quiet", "-g", pkg); err != nil {
+		return err
+	}
+
+	if err := s.Stager.LinkDirectoryInDepDir(filepath.Join(s.Stager.DepDir(), "node", "bin"), "bin"); err != nil {
+		return err
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := s.Command.Execute(s.Stager.BuildDir(), buffer, buffer, "pnpm", "--version"); err != nil {
+		return err
+	}
+
+	s.Log.Info("Installed pnpm %s", strings.TrimSpace(buffer.String()))
+	s.Report.SetTool("pnpm", s.PNPMVersion, strings.TrimSpace(buffer.String()), s.versionSource(s.Config.PNPMVersion, s.PNPMVersion))
 
 	return nil
 }
@@ -589,6 +1423,26 @@ func (s *Supplier) CreateDefaultEnv() error {
 
 	s.Log.BeginStep("Creating runtime environment")
 
+	// buildpack.yml settings only replace the defaults, so an env var set on
+	// the app still wins.
+	for _, setting := range []struct {
+		envVar string
+		key    string
+		value  *bool
+	}{
+		{"NODE_MODULES_CACHE", "node_modules_cache", s.Config.NodeModulesCache},
+		{"NODE_VERBOSE", "verbose", s.Config.Verbose},
+	} {
+		if setting.value == nil {
+			continue
+		}
+		if os.Getenv(setting.envVar) != "" {
+			s.Log.Info("%s is set in the environment, ignoring nodejs.%s from buildpack.yml", setting.envVar, setting.key)
+			continue
+		}
+		environmentDefaults[setting.envVar] = strconv.FormatBool(*setting.value)
+	}
+
 	for envVar, envDefault := range environmentDefaults {
 		if os.Getenv(envVar) == "" {
 			if err := s.Stager.WriteEnvFile(envVar, envDefault); err != nil {
@@ -601,23 +1455,106 @@ func (s *Supplier) CreateDefaultEnv() error {
 		return err
 	}
 
+	// Finalize installs the launch helper, which sizes memory, concurrency
+	// and the V8 heap from the container's cgroup limits and configures
+	// bound agents. Without it, as when another buildpack finalizes, the
+	// memory is read from VCAP_APPLICATION with sed, since stacks may not
+	// ship jq.
 	scriptContents := `export NODE_HOME=%[1]s
 export NODE_ENV=${NODE_ENV:-production}
-export MEMORY_AVAILABLE=$(echo $VCAP_APPLICATION | jq '.limits.mem')
+%[3]sif [ -x "%[4]s" ]; then
+	eval "$("%[4]s")"
+else
+	export MEMORY_AVAILABLE=$(echo "$VCAP_APPLICATION" | sed -n 's/.*"mem": *\([0-9]*\).*/\1/p')
+fi
 export WEB_MEMORY=${WEB_MEMORY:-512}
 export WEB_CONCURRENCY=${WEB_CONCURRENCY:-1}
-if [ ! -d "$HOME/node_modules" ]; then
+if [ ! -d "$HOME/node_modules" ] && [ -d "%[2]s" ]; then
 	export NODE_PATH=${NODE_PATH:-"%[2]s"}
 	ln -s "%[2]s" "$HOME/node_modules"
-else
+elif [ -d "$HOME/node_modules" ]; then
 	export NODE_PATH=${NODE_PATH:-"$HOME/node_modules"}
 fi
 export PATH=$PATH:"$HOME/bin":$NODE_PATH/.bin
 `
-	return s.Stager.WriteProfileD("node.sh",
-		fmt.Sprintf(scriptContents,
-			filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "node"),
-			filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "node_modules")))
+	// optimize_memory in buildpack.yml becomes the default of the launch
+	// helper's OPTIMIZE_MEMORY.
+	optimizeMemory := ""
+	if s.Config.OptimizeMemory != nil {
+		optimizeMemory = fmt.Sprintf("export OPTIMIZE_MEMORY=${OPTIMIZE_MEMORY:-%t}\n", *s.Config.OptimizeMemory)
+	}
+
+	script := fmt.Sprintf(scriptContents,
+		filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "node"),
+		filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), "node_modules"),
+		optimizeMemory,
+		filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), launch.Helper))
+
+	// Extra CAs trusted during staging are trusted by the app too.
+	if found, err := libbuildpack.FileExists(filepath.Join(s.Stager.DepDir(), certs.ExtraFile)); err != nil {
+		return err
+	} else if found {
+		script += fmt.Sprintf("export NODE_EXTRA_CA_CERTS=${NODE_EXTRA_CA_CERTS:-%s}\n", filepath.Join("$DEPS_DIR", s.Stager.DepsIdx(), certs.ExtraFile))
+	}
+
+	return s.Stager.WriteProfileD("node.sh", script)
+}
+
+// retargetSymlinks rewrites links in trees that were moved from the keys of
+// moved to its values. Links into any moved tree (pnpm may write absolute
+// ones) follow it; links out of them stay pointed at the same place.
+func retargetSymlinks(moved map[string]string) error {
+	for oldRoot, newRoot := range moved {
+		if err := retargetTree(oldRoot, newRoot, moved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func retargetTree(oldRoot, newRoot string, moved map[string]string) error {
+	return filepath.Walk(newRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(newRoot, path)
+		if err != nil {
+			return err
+		}
+
+		absTarget := target
+		if !filepath.IsAbs(target) {
+			absTarget = filepath.Join(filepath.Dir(filepath.Join(oldRoot, relPath)), target)
+		}
+		for from, to := range moved {
+			if rel, err := filepath.Rel(from, absTarget); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				absTarget = filepath.Join(to, rel)
+				break
+			}
+		}
+
+		newTarget, err := filepath.Rel(filepath.Dir(path), absTarget)
+		if err != nil {
+			return err
+		}
+		if newTarget == filepath.Clean(target) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		return os.Symlink(newTarget, path)
+	})
 }
 
 func copyAll(srcDir, destDir string, files []string) error {
@@ -0,0 +1,182 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+type Workspace struct {
+	Dir  string
+	Name string
+}
+
+// Selected returns the workspace named by NODE_WORKSPACE, falling back to
+// configured (the workspace key in buildpack.yml). It returns an empty
+// Workspace when the app is staged from the repo root.
+func Selected(buildDir, configured string) (Workspace, error) {
+	selector := os.Getenv("NODE_WORKSPACE")
+	if selector == "" {
+		selector = configured
+	}
+	if selector == "" {
+		return Workspace{}, nil
+	}
+	return Resolve(buildDir, selector)
+}
+
+// Resolve finds a workspace by its directory, relative to buildDir, or by
+// the name in its package.json.
+func Resolve(buildDir, selector string) (Workspace, error) {
+	dirs, err := Dirs(buildDir)
+	if err != nil {
+		return Workspace{}, err
+	}
+	if len(dirs) == 0 {
+		return Workspace{}, fmt.Errorf("workspace %s requested, but the app does not declare any workspaces", selector)
+	}
+
+	cleaned := filepath.Clean(selector)
+	for _, dir := range dirs {
+		name, err := packageName(filepath.Join(buildDir, dir))
+		if err != nil {
+			return Workspace{}, err
+		}
+		if dir == cleaned || name == selector {
+			return Workspace{Dir: dir, Name: name}, nil
+		}
+	}
+
+	return Workspace{}, fmt.Errorf("workspace %s not found, the app declares: %s", selector, strings.Join(dirs, ", "))
+}
+
+// Dirs lists the workspace directories, relative to buildDir, declared by
+// package.json (npm and yarn) or pnpm-workspace.yaml.
+func Dirs(buildDir string) ([]string, error) {
+	patterns, err := patterns(buildDir)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	for _, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		matches, err := expand(buildDir, strings.TrimPrefix(pattern, "!"))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			found[match] = !exclude
+		}
+	}
+
+	dirs := []string{}
+	for dir, included := range found {
+		if included {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+func patterns(buildDir string) ([]string, error) {
+	var p struct {
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	if err := libbuildpack.NewJSON().Load(filepath.Join(buildDir, "package.json"), &p); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(p.Workspaces) > 0 {
+		var list []string
+		if err := json.Unmarshal(p.Workspaces, &list); err == nil {
+			return list, nil
+		}
+
+		var yarnStyle struct {
+			Packages []string `json:"packages"`
+		}
+		if err := json.Unmarshal(p.Workspaces, &yarnStyle); err != nil {
+			return nil, fmt.Errorf("could not parse workspaces in package.json: %s", err)
+		}
+		return yarnStyle.Packages, nil
+	}
+
+	var pnpmWorkspace struct {
+		Packages []string `yaml:"packages"`
+	}
+	if err := libbuildpack.NewYAML().Load(filepath.Join(buildDir, "pnpm-workspace.yaml"), &pnpmWorkspace); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return pnpmWorkspace.Packages, nil
+}
+
+// expand matches a workspace glob against directories holding a
+// package.json. A "**" segment matches any depth below its prefix.
+func expand(buildDir, pattern string) ([]string, error) {
+	pattern = filepath.Clean(filepath.FromSlash(pattern))
+
+	var candidates []string
+	if idx := strings.Index(pattern, "**"); idx >= 0 {
+		prefixes, err := filepath.Glob(filepath.Join(buildDir, pattern[:idx]))
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range prefixes {
+			err := filepath.Walk(prefix, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() && info.Name() == "node_modules" {
+					return filepath.SkipDir
+				}
+				if info.IsDir() {
+					candidates = append(candidates, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		var err error
+		if candidates, err = filepath.Glob(filepath.Join(buildDir, pattern)); err != nil {
+			return nil, err
+		}
+	}
+
+	var dirs []string
+	for _, candidate := range candidates {
+		if found, err := libbuildpack.FileExists(filepath.Join(candidate, "package.json")); err != nil {
+			return nil, err
+		} else if !found {
+			continue
+		}
+
+		dir, err := filepath.Rel(buildDir, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if dir != "." {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
+func packageName(dir string) (string, error) {
+	var p struct {
+		Name string `json:"name"`
+	}
+	if err := libbuildpack.NewJSON().Load(filepath.Join(dir, "package.json"), &p); err != nil {
+		return "", err
+	}
+	return p.Name, nil
+}
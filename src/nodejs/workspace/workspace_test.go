@@ -0,0 +1,112 @@
+package workspace_test
+
+import (
+	"io/ioutil"
+	"nodejs/workspace"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Workspace", func() {
+	var (
+		err      error
+		buildDir string
+	)
+
+	BeforeEach(func() {
+		buildDir, err = ioutil.TempDir("", "nodejs-buildpack.build.")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(buildDir)).To(Succeed())
+	})
+
+	writeFile := func(name, contents string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(buildDir, name)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(buildDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("Dirs", func() {
+		It("expands the package.json workspaces globs", func() {
+			writeFile("package.json", `{"workspaces": ["packages/*", "!packages/legacy"]}`)
+			writeFile("packages/api/package.json", `{"name": "@acme/api"}`)
+			writeFile("packages/web/package.json", `{"name": "@acme/web"}`)
+			writeFile("packages/legacy/package.json", `{"name": "@acme/legacy"}`)
+			Expect(os.MkdirAll(filepath.Join(buildDir, "packages", "docs"), 0755)).To(Succeed())
+
+			Expect(workspace.Dirs(buildDir)).To(Equal([]string{"packages/api", "packages/web"}))
+		})
+
+		It("understands the yarn 1 object form", func() {
+			writeFile("package.json", `{"workspaces": {"packages": ["apps/**"]}}`)
+			writeFile("apps/group/api/package.json", `{"name": "api"}`)
+
+			Expect(workspace.Dirs(buildDir)).To(Equal([]string{"apps/group/api"}))
+		})
+
+		It("reads pnpm-workspace.yaml", func() {
+			writeFile("package.json", `{}`)
+			writeFile("pnpm-workspace.yaml", "packages:\n  - 'services/*'\n")
+			writeFile("services/api/package.json", `{"name": "api"}`)
+
+			Expect(workspace.Dirs(buildDir)).To(Equal([]string{"services/api"}))
+		})
+	})
+
+	Describe("Resolve", func() {
+		BeforeEach(func() {
+			writeFile("package.json", `{"workspaces": ["packages/*"]}`)
+			writeFile("packages/api/package.json", `{"name": "@acme/api"}`)
+		})
+
+		It("finds a workspace by directory", func() {
+			Expect(workspace.Resolve(buildDir, "./packages/api/")).To(Equal(workspace.Workspace{Dir: "packages/api", Name: "@acme/api"}))
+		})
+
+		It("finds a workspace by package name", func() {
+			Expect(workspace.Resolve(buildDir, "@acme/api")).To(Equal(workspace.Workspace{Dir: "packages/api", Name: "@acme/api"}))
+		})
+
+		It("lists the declared workspaces when there is no match", func() {
+			_, err := workspace.Resolve(buildDir, "web")
+			Expect(err).To(MatchError("workspace web not found, the app declares: packages/api"))
+		})
+	})
+
+	Describe("Selected", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("NODE_WORKSPACE")).To(Succeed())
+		})
+
+		It("stages from the repo root when NODE_WORKSPACE is unset", func() {
+			Expect(os.Unsetenv("NODE_WORKSPACE")).To(Succeed())
+			Expect(workspace.Selected(buildDir, "")).To(Equal(workspace.Workspace{}))
+		})
+
+		Context("the app has workspaces", func() {
+			BeforeEach(func() {
+				writeFile("package.json", `{"workspaces": ["packages/*"]}`)
+				writeFile("packages/api/package.json", `{"name": "@acme/api"}`)
+				writeFile("packages/web/package.json", `{"name": "@acme/web"}`)
+			})
+
+			It("resolves NODE_WORKSPACE", func() {
+				Expect(os.Setenv("NODE_WORKSPACE", "@acme/api")).To(Succeed())
+				Expect(workspace.Selected(buildDir, "")).To(Equal(workspace.Workspace{Dir: "packages/api", Name: "@acme/api"}))
+			})
+
+			It("prefers NODE_WORKSPACE over the configured workspace", func() {
+				Expect(os.Setenv("NODE_WORKSPACE", "@acme/api")).To(Succeed())
+				Expect(workspace.Selected(buildDir, "packages/web")).To(Equal(workspace.Workspace{Dir: "packages/api", Name: "@acme/api"}))
+			})
+
+			It("falls back to the configured workspace", func() {
+				Expect(workspace.Selected(buildDir, "packages/web")).To(Equal(workspace.Workspace{Dir: "packages/web", Name: "@acme/web"}))
+			})
+		})
+	})
+})
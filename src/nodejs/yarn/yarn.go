@@ -3,9 +3,12 @@ package yarn
 import (
 	"io"
 	"io/ioutil"
+	"nodejs/registry"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
@@ -16,11 +19,73 @@ type Command interface {
 }
 
 type Yarn struct {
-	Command Command
-	Log     *libbuildpack.Logger
+	Command  Command
+	Log      *libbuildpack.Logger
+	Registry *registry.Config
+}
+
+// IsBerry reports whether the app uses Yarn 2 or later, either because it
+// ships a .yarnrc.yml or because package.json pins yarn@2+ in its
+// packageManager field.
+func IsBerry(buildDir string) (bool, error) {
+	if found, err := libbuildpack.FileExists(filepath.Join(buildDir, ".yarnrc.yml")); err != nil || found {
+		return found, err
+	}
+
+	var p struct {
+		PackageManager string `json:"packageManager"`
+	}
+	if err := libbuildpack.NewJSON().Load(filepath.Join(buildDir, "package.json"), &p); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !strings.HasPrefix(p.PackageManager, "yarn@") {
+		return false, nil
+	}
+
+	major := strings.SplitN(strings.TrimPrefix(p.PackageManager, "yarn@"), ".", 2)[0]
+	n, err := strconv.Atoi(major)
+	return err == nil && n >= 2, nil
+}
+
+// YarnPath returns the yarnPath setting from .yarnrc.yml, the checked in
+// Yarn release that any yarn binary on the PATH hands off to.
+func YarnPath(buildDir string) (string, error) {
+	var rc struct {
+		YarnPath string `yaml:"yarnPath"`
+	}
+	if err := libbuildpack.NewYAML().Load(filepath.Join(buildDir, ".yarnrc.yml"), &rc); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return rc.YarnPath, nil
+}
+
+// PnPFile returns the name of the Plug'n'Play loader yarn wrote into
+// buildDir, or "" when dependencies were installed into node_modules.
+func PnPFile(buildDir string) (string, error) {
+	for _, name := range []string{".pnp.cjs", ".pnp.js"} {
+		if found, err := libbuildpack.FileExists(filepath.Join(buildDir, name)); err != nil {
+			return "", err
+		} else if found {
+			return name, nil
+		}
+	}
+	return "", nil
 }
 
 func (y *Yarn) Build(buildDir, cacheDir string) error {
+	if berry, err := IsBerry(buildDir); err != nil {
+		return err
+	} else if berry {
+		return y.buildBerry(buildDir, cacheDir)
+	}
+
 	y.Log.Info("Installing node modules (yarn.lock)")
 
 	offline, err := libbuildpack.FileExists(filepath.Join(buildDir, "npm-packages-offline-cache"))
@@ -65,6 +130,7 @@ func (y *Yarn) Build(buildDir, cacheDir string) error {
 	cmd.Stdout = y.Log.Output()
 	cmd.Stderr = y.Log.Output()
 	cmd.Env = append(os.Environ(), "npm_config_nodedir="+os.Getenv("NODE_HOME"))
+	cmd.Env = append(cmd.Env, y.Registry.Env(false)...)
 	if err := y.Command.Run(cmd); err != nil {
 		return err
 	}
@@ -80,3 +146,64 @@ func (y *Yarn) Build(buildDir, cacheDir string) error {
 
 	return nil
 }
+
+func (y *Yarn) buildBerry(buildDir, cacheDir string) error {
+	y.Log.Info("Installing node modules (yarn.lock, Yarn Berry)")
+
+	env := append(os.Environ(),
+		"npm_config_nodedir="+os.Getenv("NODE_HOME"),
+		"YARN_GLOBAL_FOLDER="+filepath.Join(cacheDir, ".cache", "yarn-berry"),
+	)
+
+	if zeroInstall, err := libbuildpack.FileExists(filepath.Join(buildDir, ".yarn", "cache")); err != nil {
+		return err
+	} else if zeroInstall {
+		y.Log.Info("Using zero-install cache %s", filepath.Join(".yarn", "cache"))
+	} else {
+		env = append(env, "YARN_CACHE_FOLDER="+filepath.Join(cacheDir, ".cache", "yarn-berry", "cache"))
+	}
+	env = append(env, y.Registry.Env(true)...)
+
+	cmd := exec.Command("yarn", "install", "--immutable")
+	cmd.Dir = buildDir
+	cmd.Stdout = y.Log.Output()
+	cmd.Stderr = y.Log.Output()
+	cmd.Env = env
+	return y.Command.Run(cmd)
+}
+
+// Prune removes devDependencies from node_modules, once the build scripts
+// that needed them have run. Yarn 1 has no prune command, so it reinstalls
+// the production tree from its cache; Yarn 2+ focuses every workspace on
+// its production dependencies, which needs the workspace-tools plugin
+// before Yarn 4.
+func (y *Yarn) Prune(buildDir, cacheDir string) error {
+	if berry, err := IsBerry(buildDir); err != nil {
+		return err
+	} else if berry {
+		y.Log.Info("Pruning devDependencies with yarn workspaces focus --production")
+
+		env := append(os.Environ(), "YARN_GLOBAL_FOLDER="+filepath.Join(cacheDir, ".cache", "yarn-berry"))
+		if zeroInstall, err := libbuildpack.FileExists(filepath.Join(buildDir, ".yarn", "cache")); err != nil {
+			return err
+		} else if !zeroInstall {
+			env = append(env, "YARN_CACHE_FOLDER="+filepath.Join(cacheDir, ".cache", "yarn-berry", "cache"))
+		}
+
+		cmd := exec.Command("yarn", "workspaces", "focus", "--all", "--production")
+		cmd.Dir = buildDir
+		cmd.Stdout = y.Log.Output()
+		cmd.Stderr = y.Log.Output()
+		cmd.Env = append(env, y.Registry.Env(true)...)
+		return y.Command.Run(cmd)
+	}
+
+	y.Log.Info("Pruning devDependencies with yarn install --production")
+
+	cmd := exec.Command("yarn", "install", "--production", "--pure-lockfile", "--ignore-engines", "--ignore-scripts", "--prefer-offline", "--cache-folder", filepath.Join(cacheDir, ".cache/yarn"), "--modules-folder", filepath.Join(buildDir, "node_modules"))
+	cmd.Dir = buildDir
+	cmd.Stdout = y.Log.Output()
+	cmd.Stderr = y.Log.Output()
+	cmd.Env = append(os.Environ(), y.Registry.Env(false)...)
+	return y.Command.Run(cmd)
+}
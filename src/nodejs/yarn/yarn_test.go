@@ -3,6 +3,7 @@ package yarn_test
 import (
 	"bytes"
 	"io/ioutil"
+	"nodejs/registry"
 	"nodejs/yarn"
 	"os"
 	"os/exec"
@@ -59,6 +60,7 @@ var _ = Describe("Yarn", func() {
 		var oldNodeHome string
 		var yarnConfig map[string]string
 		var yarnInstallArgs []string
+		var yarnInstallEnv []string
 
 		AfterEach(func() {
 			Expect(os.Setenv("NODE_HOME", oldNodeHome)).To(Succeed())
@@ -75,6 +77,7 @@ var _ = Describe("Yarn", func() {
 					yarnConfig[cmd.Args[3]] = cmd.Args[4]
 				default:
 					yarnInstallArgs = cmd.Args
+					yarnInstallEnv = cmd.Env
 					Expect(cmd.Env).To(ContainElement("npm_config_nodedir=test_node_home"))
 				}
 				Expect(cmd.Dir).To(Equal(buildDir))
@@ -132,6 +135,48 @@ var _ = Describe("Yarn", func() {
 			})
 		})
 
+		Context("the app uses Yarn Berry", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, ".yarnrc.yml"), []byte("nodeLinker: pnp\n"), 0644)).To(Succeed())
+			})
+
+			It("runs yarn install --immutable without yarn 1 config or yarn check", func() {
+				Expect(y.Build(buildDir, cacheDir)).To(Succeed())
+				Expect(buffer.String()).To(ContainSubstring("Installing node modules (yarn.lock, Yarn Berry)"))
+				Expect(yarnInstallArgs).To(Equal([]string{"yarn", "install", "--immutable"}))
+				Expect(yarnConfig).To(BeEmpty())
+			})
+
+			It("keeps the yarn cache in the cache dir", func() {
+				Expect(y.Build(buildDir, cacheDir)).To(Succeed())
+				Expect(yarnInstallEnv).To(ContainElement("YARN_CACHE_FOLDER=" + filepath.Join(cacheDir, ".cache", "yarn-berry", "cache")))
+				Expect(yarnInstallEnv).To(ContainElement("npm_config_nodedir=test_node_home"))
+			})
+
+			Context("the app has a zero-install cache", func() {
+				BeforeEach(func() {
+					Expect(os.MkdirAll(filepath.Join(buildDir, ".yarn", "cache"), 0755)).To(Succeed())
+				})
+
+				It("uses the app's .yarn/cache", func() {
+					Expect(y.Build(buildDir, cacheDir)).To(Succeed())
+					Expect(buffer.String()).To(ContainSubstring("Using zero-install cache .yarn/cache"))
+					for _, env := range yarnInstallEnv {
+						Expect(env).NotTo(HavePrefix("YARN_CACHE_FOLDER="))
+					}
+				})
+			})
+
+			It("reads the generated .yarnrc.yml when registries are configured", func() {
+				y.Registry = &registry.Config{}
+				Expect(y.Registry.Write([]registry.Registry{{URL: "https://npm.example.com/", Token: "abc"}})).To(Succeed())
+				defer y.Registry.Remove()
+
+				Expect(y.Build(buildDir, cacheDir)).To(Succeed())
+				Expect(yarnInstallEnv).To(ContainElement("HOME=" + filepath.Dir(y.Registry.NPMRC(""))))
+			})
+		})
+
 		Context("NO npm-packages-offline-cache directory", func() {
 			JustBeforeEach(func() {
 				mockCommand.EXPECT().Execute(buildDir, ioutil.Discard, gomock.Any(), "yarn", []string{"check"}).Return(yarnCheck)
@@ -157,6 +202,15 @@ var _ = Describe("Yarn", func() {
 				Expect(yarnInstallArgs).To(Equal([]string{"yarn", "install", "--pure-lockfile", "--ignore-engines", "--cache-folder", filepath.Join(cacheDir, ".cache/yarn"), "--modules-folder", filepath.Join(buildDir, "node_modules")}))
 			})
 
+			It("reads the generated npmrc when registries are configured", func() {
+				y.Registry = &registry.Config{}
+				Expect(y.Registry.Write([]registry.Registry{{Scope: "@corp", URL: "https://npm.corp.example.com/"}})).To(Succeed())
+				defer y.Registry.Remove()
+
+				Expect(y.Build(buildDir, cacheDir)).To(Succeed())
+				Expect(yarnInstallEnv).To(ContainElement("NPM_CONFIG_USERCONFIG=" + y.Registry.NPMRC("")))
+			})
+
 			Context("package.json matches yarn.lock", func() {
 				BeforeEach(func() {
 					yarnCheck = nil
@@ -180,4 +234,73 @@ var _ = Describe("Yarn", func() {
 			})
 		})
 	})
+
+	Describe("Prune", func() {
+		var args, env []string
+
+		BeforeEach(func() {
+			mockCommand.EXPECT().Run(gomock.Any()).Do(func(cmd *exec.Cmd) {
+				Expect(cmd.Dir).To(Equal(buildDir))
+				args = cmd.Args
+				env = cmd.Env
+			}).Return(nil)
+		})
+
+		It("reinstalls the production tree without running scripts", func() {
+			Expect(y.Prune(buildDir, cacheDir)).To(Succeed())
+			Expect(args).To(Equal([]string{"yarn", "install", "--production", "--pure-lockfile", "--ignore-engines", "--ignore-scripts", "--prefer-offline", "--cache-folder", filepath.Join(cacheDir, ".cache/yarn"), "--modules-folder", filepath.Join(buildDir, "node_modules")}))
+			Expect(buffer.String()).To(ContainSubstring("Pruning devDependencies with yarn install --production"))
+		})
+
+		Context("the app uses Yarn Berry", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(buildDir, ".yarnrc.yml"), []byte("nodeLinker: node-modules\n"), 0644)).To(Succeed())
+			})
+
+			It("focuses every workspace on production dependencies", func() {
+				Expect(y.Prune(buildDir, cacheDir)).To(Succeed())
+				Expect(args).To(Equal([]string{"yarn", "workspaces", "focus", "--all", "--production"}))
+				Expect(env).To(ContainElement("YARN_CACHE_FOLDER=" + filepath.Join(cacheDir, ".cache", "yarn-berry", "cache")))
+			})
+		})
+	})
+
+	Describe("IsBerry", func() {
+		It("is false for a yarn 1 app", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"packageManager": "yarn@1.22.19"}`), 0644)).To(Succeed())
+			Expect(yarn.IsBerry(buildDir)).To(BeFalse())
+		})
+
+		It("is true when .yarnrc.yml exists", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, ".yarnrc.yml"), []byte(""), 0644)).To(Succeed())
+			Expect(yarn.IsBerry(buildDir)).To(BeTrue())
+		})
+
+		It("is true when packageManager pins yarn 2 or later", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "package.json"), []byte(`{"packageManager": "yarn@3.6.1+sha224.abc"}`), 0644)).To(Succeed())
+			Expect(yarn.IsBerry(buildDir)).To(BeTrue())
+		})
+	})
+
+	Describe("YarnPath", func() {
+		It("returns yarnPath from .yarnrc.yml", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, ".yarnrc.yml"), []byte("yarnPath: .yarn/releases/yarn-3.6.1.cjs\n"), 0644)).To(Succeed())
+			Expect(yarn.YarnPath(buildDir)).To(Equal(".yarn/releases/yarn-3.6.1.cjs"))
+		})
+
+		It("returns nothing without .yarnrc.yml", func() {
+			Expect(yarn.YarnPath(buildDir)).To(Equal(""))
+		})
+	})
+
+	Describe("PnPFile", func() {
+		It("finds .pnp.cjs", func() {
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, ".pnp.cjs"), []byte(""), 0644)).To(Succeed())
+			Expect(yarn.PnPFile(buildDir)).To(Equal(".pnp.cjs"))
+		})
+
+		It("returns nothing for a node_modules install", func() {
+			Expect(yarn.PnPFile(buildDir)).To(Equal(""))
+		})
+	})
 })